@@ -0,0 +1,94 @@
+package cipher
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// RFC 8439 ChaCha20 密钥流（标准库未公开该算法）。
+const (
+	chachaNonceSize = 12
+	chachaBlockSize = 64
+)
+
+type chacha20 struct {
+	key     [8]uint32
+	nonce   [3]uint32
+	counter uint32
+	// 当前块的密钥流及已用字节数
+	buf [chachaBlockSize]byte
+	off int
+	// 计数器已回绕：密钥流耗尽（256GiB）
+	exhausted bool
+}
+
+func newChaCha20(key, nonce []byte) *chacha20 {
+	c := &chacha20{off: chachaBlockSize}
+	for i := range c.key {
+		c.key[i] = binary.LittleEndian.Uint32(key[4*i:])
+	}
+	for i := range c.nonce {
+		c.nonce[i] = binary.LittleEndian.Uint32(nonce[4*i:])
+	}
+	return c
+}
+
+// XORKeyStream 实现 crypto/cipher.Stream。
+func (c *chacha20) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("cipher: output smaller than input")
+	}
+	for i := range src {
+		if c.off == chachaBlockSize {
+			c.refill()
+		}
+		dst[i] = src[i] ^ c.buf[c.off]
+		c.off++
+	}
+}
+
+func (c *chacha20) refill() {
+	if c.exhausted {
+		panic("cipher: ChaCha20 keystream exhausted")
+	}
+	c.block(&c.buf)
+	c.off = 0
+	c.counter++
+	c.exhausted = c.counter == 0
+}
+
+func quarterRound(a, b, c, d uint32) (uint32, uint32, uint32, uint32) {
+	a += b
+	d = bits.RotateLeft32(d^a, 16)
+	c += d
+	b = bits.RotateLeft32(b^c, 12)
+	a += b
+	d = bits.RotateLeft32(d^a, 8)
+	c += d
+	b = bits.RotateLeft32(b^c, 7)
+	return a, b, c, d
+}
+
+// block 生成当前计数器对应的 64 字节密钥流块。
+func (c *chacha20) block(out *[chachaBlockSize]byte) {
+	in := [16]uint32{
+		0x61707865, 0x3320646e, 0x79622d32, 0x6b206574,
+		c.key[0], c.key[1], c.key[2], c.key[3],
+		c.key[4], c.key[5], c.key[6], c.key[7],
+		c.counter, c.nonce[0], c.nonce[1], c.nonce[2],
+	}
+	x := in
+	for i := 0; i < 10; i++ {
+		x[0], x[4], x[8], x[12] = quarterRound(x[0], x[4], x[8], x[12])
+		x[1], x[5], x[9], x[13] = quarterRound(x[1], x[5], x[9], x[13])
+		x[2], x[6], x[10], x[14] = quarterRound(x[2], x[6], x[10], x[14])
+		x[3], x[7], x[11], x[15] = quarterRound(x[3], x[7], x[11], x[15])
+		x[0], x[5], x[10], x[15] = quarterRound(x[0], x[5], x[10], x[15])
+		x[1], x[6], x[11], x[12] = quarterRound(x[1], x[6], x[11], x[12])
+		x[2], x[7], x[8], x[13] = quarterRound(x[2], x[7], x[8], x[13])
+		x[3], x[4], x[9], x[14] = quarterRound(x[3], x[4], x[9], x[14])
+	}
+	for i := range x {
+		binary.LittleEndian.PutUint32(out[4*i:], x[i]+in[i])
+	}
+}
@@ -0,0 +1,64 @@
+package cipher
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// RFC 8439 §2.4.2
+func TestChaCha20RFC8439(t *testing.T) {
+	key := unhex(t, "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	nonce := unhex(t, "000000000000004a00000000")
+	plain := []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+	want := unhex(t, "6e2e359a2568f98041ba0728dd0d6981"+
+		"e97e7aec1d4360c20a27afccfd9fae0b"+
+		"f91b65c5524733ab8f593dabcd62b357"+
+		"1639d624e65152ab8f530c359f0861d8"+
+		"07ca0dbf500d6a6156a38e088a22b65e"+
+		"52bc514d16ccf806818ce91ab7793736"+
+		"5af90bbf74a35be6b40b8eedf2785e42"+
+		"874d")
+
+	c := newChaCha20(key, nonce)
+	c.counter = 1
+	got := make([]byte, len(plain))
+	c.XORKeyStream(got, plain)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("ciphertext mismatch\n got %x\nwant %x", got, want)
+	}
+
+	// 分段调用须与一次调用得到相同的密钥流
+	c = newChaCha20(key, nonce)
+	c.counter = 1
+	got = make([]byte, len(plain))
+	for i, n := 0, 1; i < len(plain); i, n = i+n, n+7 {
+		end := min(i+n, len(plain))
+		c.XORKeyStream(got[i:end], plain[i:end])
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("chunked ciphertext mismatch\n got %x\nwant %x", got, want)
+	}
+}
+
+func TestChaCha20Exhausted(t *testing.T) {
+	c := newChaCha20(make([]byte, 32), make([]byte, chachaNonceSize))
+	c.counter = ^uint32(0)
+	buf := make([]byte, chachaBlockSize)
+	c.XORKeyStream(buf, buf)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic after counter wrap")
+		}
+	}()
+	c.XORKeyStream(buf[:1], buf[:1])
+}
@@ -0,0 +1,157 @@
+// Package cipher 提供满足 server.Cipher / client.Cipher 的长度不变流密码实现：
+// 每个方向（客户端→服务端、服务端→客户端）使用独立的密钥、nonce 与计数器，
+// EncryptInPlace 与 DecryptInPlace 各自推进本方向的密钥流，可分别在写入方与读取方 goroutine 中调用。
+//
+// 流密码不提供完整性保护；同一 (密钥, nonce) 绝不能用于两个连接，
+// 以共享秘密派生时须为每个连接给出不同的 salt（例如握手交换的随机数）。
+package cipher
+
+import (
+	"crypto/aes"
+	stdcipher "crypto/cipher"
+	"errors"
+)
+
+// Suite 选择密钥流算法。
+type Suite uint8
+
+const (
+	// AES256CTR 为 AES-256 计数器模式：32 字节密钥，16 字节初始计数块。
+	AES256CTR Suite = iota + 1
+	// ChaCha20 为 RFC 8439 ChaCha20：32 字节密钥，12 字节 nonce，块计数从 0 开始。
+	ChaCha20
+)
+
+// KeySize 返回密钥长度。
+func (s Suite) KeySize() int { return 32 }
+
+// NonceSize 返回 nonce（AES-CTR 为初始计数块）长度。
+func (s Suite) NonceSize() int {
+	if s == ChaCha20 {
+		return chachaNonceSize
+	}
+	return aes.BlockSize
+}
+
+func (s Suite) String() string {
+	switch s {
+	case AES256CTR:
+		return "aes-256-ctr"
+	case ChaCha20:
+		return "chacha20"
+	}
+	return "unknown"
+}
+
+// Side 表示本端在连接中的角色，决定哪个方向的密钥用于发送。
+type Side uint8
+
+const (
+	Client Side = iota
+	Server
+)
+
+var (
+	ErrUnknownSuite = errors.New("cipher: unknown suite")
+	ErrKeySize      = errors.New("cipher: invalid key or nonce size")
+)
+
+// Keys 为单个方向的密钥材料。
+type Keys struct {
+	Key   []byte
+	Nonce []byte
+}
+
+// Stream 是一对方向独立的密钥流：发送方向用于 EncryptInPlace，接收方向用于 DecryptInPlace。
+type Stream struct {
+	suite Suite
+	side  Side
+	tx    stdcipher.Stream
+	rx    stdcipher.Stream
+}
+
+// NewStream 以给定的发送/接收方向密钥材料创建 Stream。
+func NewStream(suite Suite, tx, rx Keys) (*Stream, error) {
+	ts, err := newKeystream(suite, tx)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := newKeystream(suite, rx)
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{suite: suite, tx: ts, rx: rs}, nil
+}
+
+// NewPending 创建尚未装入密钥的 Stream，由握手完成后调用 InstallKeys 派生密钥
+// （server.Config.Handshake / client.Config.Handshake）。装入密钥前不得加解密。
+func NewPending(suite Suite, side Side) *Stream {
+	return &Stream{suite: suite, side: side}
+}
+
+// InstallKeys 由握手派生的共享秘密按 New 的规则装入两个方向的密钥，
+// 实现 server.KeyInstaller 与 client.KeyInstaller。
+func (s *Stream) InstallKeys(secret, salt []byte) error {
+	ns, err := New(s.suite, s.side, secret, salt)
+	if err != nil {
+		return err
+	}
+	s.tx, s.rx = ns.tx, ns.rx
+	return nil
+}
+
+// New 由共享秘密经 HKDF-SHA256 派生两个方向的密钥材料，并按 side 分配收发方向。
+// 两端以相同的 secret、salt 与 suite 调用（side 相反）即可互通。
+func New(suite Suite, side Side, secret, salt []byte) (*Stream, error) {
+	c2s, s2c, err := DeriveKeys(suite, secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	tx, rx := c2s, s2c
+	if side == Server {
+		tx, rx = s2c, c2s
+	}
+	s, err := NewStream(suite, tx, rx)
+	if err != nil {
+		return nil, err
+	}
+	s.side = side
+	return s, nil
+}
+
+// DeriveKeys 由共享秘密派生客户端→服务端与服务端→客户端两个方向的密钥材料。
+func DeriveKeys(suite Suite, secret, salt []byte) (c2s, s2c Keys, _ error) {
+	if suite != AES256CTR && suite != ChaCha20 {
+		return c2s, s2c, ErrUnknownSuite
+	}
+	ks, ns := suite.KeySize(), suite.NonceSize()
+	prk := hkdfExtract(salt, secret)
+	okm := hkdfExpand(prk, []byte("gio "+suite.String()+" c2s"), ks+ns)
+	c2s = Keys{Key: okm[:ks], Nonce: okm[ks:]}
+	okm = hkdfExpand(prk, []byte("gio "+suite.String()+" s2c"), ks+ns)
+	s2c = Keys{Key: okm[:ks], Nonce: okm[ks:]}
+	return c2s, s2c, nil
+}
+
+// EncryptInPlace 以发送方向的密钥流原地加密 p。
+func (s *Stream) EncryptInPlace(p []byte) { s.tx.XORKeyStream(p, p) }
+
+// DecryptInPlace 以接收方向的密钥流原地解密 p。
+func (s *Stream) DecryptInPlace(p []byte) { s.rx.XORKeyStream(p, p) }
+
+func newKeystream(suite Suite, k Keys) (stdcipher.Stream, error) {
+	if len(k.Key) != suite.KeySize() || len(k.Nonce) != suite.NonceSize() {
+		return nil, ErrKeySize
+	}
+	switch suite {
+	case AES256CTR:
+		b, err := aes.NewCipher(k.Key)
+		if err != nil {
+			return nil, err
+		}
+		return stdcipher.NewCTR(b, k.Nonce), nil
+	case ChaCha20:
+		return newChaCha20(k.Key, k.Nonce), nil
+	}
+	return nil, ErrUnknownSuite
+}
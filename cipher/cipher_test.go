@@ -0,0 +1,151 @@
+package cipher_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/legamerdc/gio/cipher"
+	"github.com/legamerdc/gio/client"
+	"github.com/legamerdc/gio/server"
+)
+
+var suites = []cipher.Suite{cipher.AES256CTR, cipher.ChaCha20}
+
+func TestStreamSides(t *testing.T) {
+	secret, salt := []byte("shared secret"), []byte("salt")
+	for _, suite := range suites {
+		t.Run(suite.String(), func(t *testing.T) {
+			cs, err := cipher.New(suite, cipher.Client, secret, salt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ss := cipher.NewPending(suite, cipher.Server)
+			if err := ss.InstallKeys(secret, salt); err != nil {
+				t.Fatal(err)
+			}
+			for i := range 50 {
+				msg := bytes.Repeat([]byte{byte(i)}, 1+i*17)
+				p := append([]byte(nil), msg...)
+				cs.EncryptInPlace(p)
+				if bytes.Equal(p, msg) {
+					t.Fatalf("message %d not encrypted", i)
+				}
+				ss.DecryptInPlace(p)
+				if !bytes.Equal(p, msg) {
+					t.Fatalf("c2s message %d mismatch", i)
+				}
+				ss.EncryptInPlace(p)
+				cs.DecryptInPlace(p)
+				if !bytes.Equal(p, msg) {
+					t.Fatalf("s2c message %d mismatch", i)
+				}
+			}
+		})
+	}
+}
+
+func TestDeriveKeysDirections(t *testing.T) {
+	c2s, s2c, err := cipher.DeriveKeys(cipher.ChaCha20, []byte("k"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(c2s.Key, s2c.Key) {
+		t.Fatal("both directions share a key")
+	}
+	if _, _, err := cipher.DeriveKeys(cipher.Suite(99), []byte("k"), nil); err != cipher.ErrUnknownSuite {
+		t.Fatalf("unknown suite: got %v", err)
+	}
+}
+
+type echoHandler struct{}
+
+func (echoHandler) OnOpen(c *server.Conn[*cipher.Stream]) {}
+
+func (echoHandler) OnMessage(c *server.Conn[*cipher.Stream], api uint16, msg []byte) bool {
+	// 交替覆盖立即、压缩与延迟批量三种发送路径
+	switch msg[0] % 3 {
+	case 0:
+		_ = c.Write(msg, api)
+	case 1:
+		_ = c.Write(msg, api, server.Compress)
+	default:
+		_ = c.Write(msg, api, server.Delayed(time.Millisecond))
+	}
+	return false
+}
+
+func (echoHandler) OnClose(c *server.Conn[*cipher.Stream], err error) {}
+
+type clientHandler struct{ recv chan []byte }
+
+func (clientHandler) OnOpen(c *client.Client) {}
+
+func (h clientHandler) OnMessage(c *client.Client, api uint16, msg []byte) {
+	h.recv <- append([]byte(nil), msg...)
+}
+
+func (clientHandler) OnClose(c *client.Client, err error) {}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// TestServerClientRoundTrip 经握手派生密钥，校验服务端与客户端的 Stream 在各发送路径上互通。
+func TestServerClientRoundTrip(t *testing.T) {
+	for _, suite := range suites {
+		t.Run(suite.String(), func(t *testing.T) {
+			key, err := ecdh.X25519().GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr := freeAddr(t)
+			srv, err := server.Start[*cipher.Stream](server.Config[*cipher.Stream]{
+				ListenNetwork: "tcp",
+				ListenAddress: addr,
+				Handshake:     true,
+				HandshakeKey:  key,
+				NewCipher:     func() *cipher.Stream { return cipher.NewPending(suite, cipher.Server) },
+			}, echoHandler{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer srv.Stop(context.Background())
+
+			h := clientHandler{recv: make(chan []byte, 1)}
+			c, err := client.DialConfig("tcp", addr, client.Config{
+				Cipher:    cipher.NewPending(suite, cipher.Client),
+				Handshake: true,
+				ServerKey: key.PublicKey(),
+			}, h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			for i := range 100 {
+				msg := bytes.Repeat([]byte{byte(i)}, 1+i*13)
+				if err := c.Write(1, msg); err != nil {
+					t.Fatal(err)
+				}
+				select {
+				case got := <-h.recv:
+					if !bytes.Equal(got, msg) {
+						t.Fatalf("message %d mismatch", i)
+					}
+				case <-time.After(2 * time.Second):
+					t.Fatalf("message %d timeout", i)
+				}
+			}
+		})
+	}
+}
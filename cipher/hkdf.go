@@ -0,0 +1,38 @@
+package cipher
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// HKDF 按 RFC 5869（HMAC-SHA256）由输入密钥材料派生 n 字节输出，n 不超过 255*32。
+func HKDF(secret, salt, info []byte, n int) []byte {
+	return hkdfExpand(hkdfExtract(salt, secret), info, n)
+}
+
+func hkdfExtract(salt, ikm []byte) []byte {
+	if len(salt) == 0 {
+		salt = make([]byte, sha256.Size)
+	}
+	m := hmac.New(sha256.New, salt)
+	m.Write(ikm)
+	return m.Sum(nil)
+}
+
+func hkdfExpand(prk, info []byte, n int) []byte {
+	if n > 255*sha256.Size {
+		panic("cipher: HKDF output too long")
+	}
+	m := hmac.New(sha256.New, prk)
+	out := make([]byte, 0, n+sha256.Size)
+	var t []byte
+	for i := byte(1); len(out) < n; i++ {
+		m.Reset()
+		m.Write(t)
+		m.Write(info)
+		m.Write([]byte{i})
+		t = m.Sum(t[:0])
+		out = append(out, t...)
+	}
+	return out[:n]
+}
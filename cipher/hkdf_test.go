@@ -0,0 +1,54 @@
+package cipher
+
+import (
+	"bytes"
+	"testing"
+)
+
+// RFC 5869 附录 A.1–A.3（SHA-256）
+func TestHKDFRFC5869(t *testing.T) {
+	seq := func(from, n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(from + i)
+		}
+		return b
+	}
+	tests := []struct {
+		name            string
+		ikm, salt, info []byte
+		n               int
+		prk, okm        string
+	}{
+		{
+			name: "A.1",
+			ikm:  bytes.Repeat([]byte{0x0b}, 22), salt: seq(0x00, 13), info: seq(0xf0, 10), n: 42,
+			prk: "077709362c2e32df0ddc3f0dc47bba6390b6c73bb50f9c3122ec844ad7c2b3e5",
+			okm: "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865",
+		},
+		{
+			name: "A.2",
+			ikm:  seq(0x00, 80), salt: seq(0x60, 80), info: seq(0xb0, 80), n: 82,
+			prk: "06a6b88c5853361a06104c9ceb35b45cef760014904671014a193f40c15fc244",
+			okm: "b11e398dc80327a1c8e7f78c596a49344f012eda2d4efad8a050cc4c19afa97c" +
+				"59045a99cac7827271cb41c65e590e09da3275600c2f09b8367793a9aca3db71" +
+				"cc30c58179ec3e87c14c01d5c1f3434f1d87",
+		},
+		{
+			name: "A.3",
+			ikm:  bytes.Repeat([]byte{0x0b}, 22), n: 42,
+			prk: "19ef24a32c717b167f33a91d6f648bdf96596776afdb6377ac434c1c293ccb04",
+			okm: "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if prk := hkdfExtract(tt.salt, tt.ikm); !bytes.Equal(prk, unhex(t, tt.prk)) {
+				t.Fatalf("PRK mismatch\n got %x\nwant %s", prk, tt.prk)
+			}
+			if okm := HKDF(tt.ikm, tt.salt, tt.info, tt.n); !bytes.Equal(okm, unhex(t, tt.okm)) {
+				t.Fatalf("OKM mismatch\n got %x\nwant %s", okm, tt.okm)
+			}
+		})
+	}
+}
@@ -1,80 +1,404 @@
 package client
 
 import (
-	"log"
+	"crypto/ecdh"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"net"
 	"sync"
+	"time"
 
+	"github.com/legamerdc/gio/internal/handshake"
+	"github.com/legamerdc/gio/internal/rtt"
 	"github.com/legamerdc/gio/protocol"
 )
 
 type Handler interface {
 	OnOpen(c *Client)
+	// OnMessage 在读 goroutine 中按到达顺序调用；msg 仅在调用期间有效，需要保留时调用 c.Retain。
 	OnMessage(c *Client, api uint16, msg []byte)
 	OnClose(c *Client, err error)
 }
 
+var (
+	// ErrReservedApi 表示试图以保留的控制帧 api 发送业务消息。
+	ErrReservedApi = protocol.ErrReservedApi
+	// ErrIdleTimeout 表示在 Config.IdleTimeout 内未收到服务端任何数据。
+	ErrIdleTimeout = errors.New("client: idle timeout")
+	// ErrHandshakeFailed 表示握手失败（服务端公钥不符、密钥确认失败或连接中断），
+	// 具体原因包装在其中，可用 errors.Is 判断。
+	ErrHandshakeFailed = errors.New("client: handshake failed")
+	// 握手失败的具体原因，包装在 ErrHandshakeFailed 中：服务端静态公钥与 Config.ServerKey 不符、
+	// 握手消息非法、版本不受支持、密钥确认失败、收到当前阶段不应出现的握手消息。
+	ErrServerKey           = handshake.ErrServerKey
+	ErrHandshakeMalformed  = handshake.ErrMalformed
+	ErrHandshakeVersion    = handshake.ErrVersion
+	ErrHandshakeBadMAC     = handshake.ErrBadMAC
+	ErrHandshakeUnexpected = handshake.ErrUnexpected
+	// ErrNoKeyInstaller 表示启用 Config.Handshake 时 Config.Cipher 未实现 KeyInstaller。
+	ErrNoKeyInstaller = errors.New("client: handshake requires a Cipher implementing KeyInstaller")
+	// ErrHandshakeTimeout 表示未在 Config.HandshakeTimeout 内完成握手。
+	ErrHandshakeTimeout = errors.New("client: handshake timeout")
+	// ErrAuthFailed 表示认证帧校验失败（被篡改、重放或乱序），见 Config.FrameAEAD。
+	ErrAuthFailed = protocol.ErrAuthFailed
+)
+
+// KeyInstaller 可由 Cipher 额外实现：握手完成后以派生的共享秘密调用 InstallKeys（见 cipher.Stream）。
+type KeyInstaller interface {
+	InstallKeys(secret, salt []byte) error
+}
+
+// Cipher 为原地加解密钩子，须与服务端 Config.NewCipher 创建的实例对应：
+// 业务消息负载在压缩与组帧之前 EncryptInPlace，接收时切帧并解压后 DecryptInPlace。
+// 控制帧不经过 Cipher。
+type Cipher interface {
+	EncryptInPlace(p []byte)
+	DecryptInPlace(p []byte)
+}
+
+// Config 为客户端可选配置，零值即 Dial 的行为。
+type Config struct {
+	// 非 nil 时收发的业务负载经其原地加解密
+	Cipher Cipher
+	// >0 时按此间隔向服务端发送 ping，pong 用于测量 RTT（Client.RTT）
+	HeartbeatInterval time.Duration
+	// >0 时超过此时长未收到任何数据（含服务端 ping）即以 ErrIdleTimeout 关闭
+	IdleTimeout time.Duration
+	// 为 true 时 Dial 先与服务端完成 X25519 握手（服务端须开启 Config.Handshake），
+	// 派生的秘密经 KeyInstaller 装入 Cipher 后才返回并回调 OnOpen（设置了 Cipher 时须实现 KeyInstaller）；
+	// ServerKey 非 nil 时要求服务端出示该静态公钥，用于认证服务端
+	Handshake        bool
+	ServerKey        *ecdh.PublicKey
+	HandshakeTimeout time.Duration
+	// 为 true 时在握手中要求帧级认证（AES-256-GCM），服务端未开启 Config.FrameAEAD 时
+	// Dial 以 ErrHandshakeFailed 失败；校验失败的帧以 ErrAuthFailed 关闭连接。需开启 Handshake
+	FrameAEAD bool
+	// 非 nil 时以 TLS 连接服务端（服务端须配置 Config.TLS），TLS 握手受 HandshakeTimeout 约束
+	TLS *tls.Config
+	// 压缩算法名（见 protocol.LookupCompressor），缺省 protocol.DefaultCompression，须与服务端一致；
+	// 开启 Handshake 时改为向服务端提议，以服务端选定的算法为准（Client.Compressor）；
+	// 服务端只接受其 Config.CompressionAllowed 中的提议，否则使用自己的 CompressionAlgo
+	CompressionAlgo string
+	// >0 时以此窗口启用上下文接管（见服务端 Config.ContextTakeover）：开启 Handshake 时作为提议的最大窗口，
+	// 否则须与服务端配置相同。ContextMemoryLimit >0 时为上下文状态（按实际流量计量）的内存上限，
+	// 运行中超出时通知服务端（ApiContextReset），两个方向随之回退为无状态压缩（见服务端同名配置）
+	ContextTakeover    int
+	ContextMemoryLimit int
+	// 接收方向的解析上限（见 protocol.Limits），违反时以对应错误关闭连接；
+	// 零值取与服务端相同的缺省值，MaxFrameSize 缺省与 MaxDecompressedSize 相同（同 protocol.FrameReader），
+	// 接收缓冲据此有界
+	MaxPayload          int
+	MaxFrameSize        int
+	MaxDecompressedSize int
+	MaxBatchMsgs        int
+}
+
+const defaultHandshakeTimeout = 5 * time.Second
+
+// limits 返回解析器的上限，零值字段取缺省值。
+func (cfg *Config) limits() protocol.Limits {
+	l := protocol.Limits{
+		MaxFrame:        cfg.MaxFrameSize,
+		MaxDecompressed: cfg.MaxDecompressedSize,
+		MaxBatchMsgs:    cfg.MaxBatchMsgs,
+		MaxMessage:      cfg.MaxPayload,
+	}
+	def := protocol.DefaultLimits()
+	if l.MaxDecompressed <= 0 {
+		l.MaxDecompressed = def.MaxDecompressed
+	}
+	if l.MaxBatchMsgs <= 0 {
+		l.MaxBatchMsgs = def.MaxBatchMsgs
+	}
+	if l.MaxMessage <= 0 {
+		l.MaxMessage = def.MaxMessage
+	}
+	if l.MaxFrame <= 0 {
+		l.MaxFrame = l.MaxDecompressed
+	}
+	return l
+}
+
+// GoAwayHandler 可由 Handler 额外实现：收到服务端 GOAWAY 控制帧（服务端即将关闭）时回调，
+// 由业务决定何时 Close。未实现时客户端收到 GOAWAY 后立即关闭连接。
+type GoAwayHandler interface {
+	OnGoAway(c *Client, reason string)
+}
+
 type Client struct {
 	conn net.Conn
+	cfg  Config
 	enc  *protocol.Encoder
 	prs  *protocol.Parser
 	mu   sync.Mutex
 	// 接收缓冲，跨多次 Read 累积，避免半包丢失
 	rb []byte
+	// 加密暂存、组帧与密封缓冲及帧认证的发送方向状态，受 mu 保护
+	wb     []byte
+	fb     []byte
+	sb     []byte
+	txAEAD *protocol.FrameAEAD
+	// 已停止发送上下文帧并发出 ApiContextReset，受 mu 保护
+	ctxReset bool
+	// 心跳：时间戳基准、RTT 估计与退出信号
+	epoch time.Time
+	rtt   rtt.Estimator
+	done  chan struct{}
 }
 
 func Dial(network, address string, h Handler) (*Client, error) {
+	return DialConfig(network, address, Config{}, h)
+}
+
+// DialConfig 按 cfg 建立连接。
+func DialConfig(network, address string, cfg Config, h Handler) (*Client, error) {
+	comp, err := protocol.LookupCompressor(cfg.CompressionAlgo)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ContextTakeover != 0 && !protocol.ValidContextWindow(cfg.ContextTakeover) {
+		return nil, protocol.ErrContextWindow
+	}
+	if cfg.Handshake && cfg.Cipher != nil {
+		if _, ok := cfg.Cipher.(KeyInstaller); !ok {
+			return nil, ErrNoKeyInstaller
+		}
+	}
 	nc, err := net.Dial(network, address)
 	if err != nil {
 		return nil, err
 	}
+	if cfg.TLS != nil {
+		if nc, err = dialTLS(nc, address, cfg); err != nil {
+			return nil, err
+		}
+	}
 	enc, _ := protocol.NewEncoder()
 	prs, _ := protocol.NewParser()
-	c := &Client{conn: nc, enc: enc, prs: prs}
+	enc.SetCompressor(comp)
+	prs.SetCompressor(comp)
+	prs.SetLimits(cfg.limits())
+	c := &Client{conn: nc, cfg: cfg, enc: enc, prs: prs, epoch: time.Now(), done: make(chan struct{})}
+	if w := c.contextWindow(); w > 0 && !cfg.Handshake {
+		c.setContext(w)
+	}
+	if cfg.Handshake {
+		if err := c.handshake(); err != nil {
+			_ = nc.Close()
+			return nil, err
+		}
+	}
 	go h.OnOpen(c)
 	go c.readLoop(h)
+	if cfg.HeartbeatInterval > 0 {
+		go c.heartbeatLoop()
+	}
 	return c, nil
 }
 
+// contextWindow 返回按配置可启用的上下文窗口，0 表示不启用。
+func (c *Client) contextWindow() int { return max(c.cfg.ContextTakeover, 0) }
+
+func (c *Client) setContext(window int) {
+	c.prs.SetContext(window)
+	c.mu.Lock()
+	c.enc.SetContext(window)
+	c.mu.Unlock()
+}
+
+// checkContext 在上下文状态超过 Config.ContextMemoryLimit 时回退为无状态压缩；在读 goroutine 中调用。
+func (c *Client) checkContext() {
+	lim := c.cfg.ContextMemoryLimit
+	if lim <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.ctxReset && c.enc.ContextMemory()+c.prs.ContextMemory() > lim {
+		c.resetContextLocked()
+	}
+}
+
+// resetContextLocked 停止发送上下文帧、释放流式编码状态并通知服务端，至多一次。调用方持有 mu。
+func (c *Client) resetContextLocked() {
+	if c.ctxReset {
+		return
+	}
+	c.ctxReset = true
+	c.enc.ResetContext()
+	_ = c.writeSingleLocked(protocol.ApiContextReset, nil)
+}
+
+// onContextReset 处理服务端的 ApiContextReset：释放解码状态，本端同样回退。
+func (c *Client) onContextReset() {
+	c.prs.ResetContext()
+	c.mu.Lock()
+	c.resetContextLocked()
+	c.mu.Unlock()
+}
+
+// Compressor 返回本连接使用的压缩算法。
+func (c *Client) Compressor() protocol.Compressor {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enc.Compressor()
+}
+
+// RTT 返回由心跳 ping/pong 测得的平滑往返时延与抖动（RFC 6298），
+// 未开启 Config.HeartbeatInterval 或尚无样本时均为 0。
+func (c *Client) RTT() (rtt, jitter time.Duration) { return c.rtt.Get() }
+
+func (c *Client) heartbeatLoop() {
+	tk := time.NewTicker(c.cfg.HeartbeatInterval)
+	defer tk.Stop()
+	var ts [protocol.PingPayloadLen]byte
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-tk.C:
+			binary.BigEndian.PutUint64(ts[:], uint64(time.Since(c.epoch)))
+			if err := c.writeControl(protocol.ApiPing, ts[:]); err != nil {
+				return
+			}
+		}
+	}
+}
+
 func (c *Client) readLoop(h Handler) {
+	err := c.readFrames(h)
+	var ne net.Error
+	if c.cfg.IdleTimeout > 0 && errors.As(err, &ne) && ne.Timeout() {
+		err = ErrIdleTimeout
+	}
+	_ = c.conn.Close()
+	close(c.done)
+	c.prs.Close()
+	c.enc.Close()
+	h.OnClose(c, err)
+}
+
+// readFrames 持续读取并交付，直到读错误或解析错误。
+func (c *Client) readFrames(h Handler) error {
+	// 握手阶段可能已多读入后续帧
+	if len(c.rb) > 0 {
+		if err := c.parseRx(h); err != nil {
+			return err
+		}
+	}
 	buf := make([]byte, 64<<10)
 	for {
+		if c.cfg.IdleTimeout > 0 {
+			_ = c.conn.SetReadDeadline(time.Now().Add(c.cfg.IdleTimeout))
+		}
 		n, err := c.conn.Read(buf)
 		if n > 0 {
 			c.rb = append(c.rb, buf[:n]...)
-			for {
-				consumed, perr := c.prs.Parse(c.rb, func(api uint16, payload []byte) error {
-					h.OnMessage(c, api, payload)
-					return nil
-				})
-				if perr != nil {
-					log.Printf("client: parse error: %v", perr)
-				}
-				if consumed == 0 {
-					break
-				}
-				// 滑动缓冲：保留未消费部分
-				c.rb = c.rb[consumed:]
+			if perr := c.parseRx(h); perr != nil {
+				return perr
 			}
 		}
 		if err != nil {
-			c.prs.Close()
-			c.enc.Close()
-			h.OnClose(c, err)
-			return
+			return err
 		}
 	}
 }
 
-func (c *Client) Write(api uint16, msg []byte) error {
-	frame, err := c.enc.EncodeSingle(api, msg, false)
-	if err != nil {
-		return err
+// parseRx 解析 rb 中的完整帧并交付，未消费的半帧留待后续数据；
+// 与服务端相同，任何解析错误都使流失去同步，返回后须关闭连接。
+func (c *Client) parseRx(h Handler) error {
+	for {
+		consumed, perr := c.prs.Parse(c.rb, func(api uint16, payload []byte) error {
+			if protocol.IsControl(api) {
+				return c.onControl(h, api, payload)
+			}
+			if c.cfg.Cipher != nil {
+				c.cfg.Cipher.DecryptInPlace(payload)
+			}
+			h.OnMessage(c, api, payload)
+			return nil
+		})
+		if perr != nil {
+			return perr
+		}
+		if consumed == 0 {
+			return nil
+		}
+		c.checkContext()
+		// 滑动缓冲：保留未消费部分
+		c.rb = c.rb[consumed:]
+	}
+}
+
+// onControl 处理框架控制帧，未定义的控制 api 返回 protocol.ErrUnknownControl。
+func (c *Client) onControl(h Handler, api uint16, payload []byte) error {
+	switch api {
+	case protocol.ApiGoAway:
+		if gh, ok := h.(GoAwayHandler); ok {
+			gh.OnGoAway(c, string(payload))
+			return nil
+		}
+		_ = c.Close()
+	case protocol.ApiPing:
+		_ = c.writeControl(protocol.ApiPong, payload)
+	case protocol.ApiPong:
+		if len(payload) != protocol.PingPayloadLen {
+			return nil
+		}
+		sent := time.Duration(binary.BigEndian.Uint64(payload))
+		c.rtt.Update(time.Since(c.epoch) - sent)
+	case protocol.ApiContextReset:
+		c.onContextReset()
+	default:
+		return fmt.Errorf("%w: %#x", protocol.ErrUnknownControl, api)
 	}
+	return nil
+}
+
+func (c *Client) writeControl(api uint16, payload []byte) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	return c.writeSingleLocked(api, payload)
+}
+
+// writeSingleLocked 将一条消息编码进复用的帧缓冲并写出，启用帧认证时先密封；调用方持有 mu。
+func (c *Client) writeSingleLocked(api uint16, msg []byte) error {
+	frame, err := c.enc.AppendSingle(c.fb[:0], api, msg, 0)
+	c.fb = frame[:0]
+	if err != nil {
+		return err
+	}
+	if c.txAEAD != nil {
+		sealed, err := c.txAEAD.Seal(c.sb[:0], frame)
+		if err != nil {
+			return err
+		}
+		c.sb = sealed[:0]
+		frame = sealed
+	}
 	_, err = c.conn.Write(frame)
 	return err
 }
 
+func (c *Client) Write(api uint16, msg []byte) error {
+	if protocol.IsControl(api) {
+		return ErrReservedApi
+	}
+	// 加密与写出在同一把锁下进行，加密顺序即线路顺序
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cfg.Cipher != nil {
+		c.wb = append(c.wb[:0], msg...)
+		c.cfg.Cipher.EncryptInPlace(c.wb)
+		msg = c.wb
+	}
+	return c.writeSingleLocked(api, msg)
+}
+
+// Retain 只能在 OnMessage 中调用，使本次 msg 在 OnMessage 返回后继续有效，直到返回的引用
+// Release（可在其他 goroutine 中释放）。批量帧与压缩帧的消息位于池化解压缓冲，保留时不拷贝。
+func (c *Client) Retain() protocol.Ref { return c.prs.Retain() }
+
 func (c *Client) Close() error { return c.conn.Close() }
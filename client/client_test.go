@@ -0,0 +1,86 @@
+package client_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/legamerdc/gio/client"
+	"github.com/legamerdc/gio/protocol"
+)
+
+// closeHandler 记录交付的 api 与关闭原因。
+type closeHandler struct {
+	recv   chan uint16
+	closed chan error
+}
+
+func newCloseHandler() closeHandler {
+	return closeHandler{recv: make(chan uint16, 16), closed: make(chan error, 1)}
+}
+
+func (closeHandler) OnOpen(c *client.Client) {}
+
+func (h closeHandler) OnMessage(c *client.Client, api uint16, msg []byte) { h.recv <- api }
+
+func (h closeHandler) OnClose(c *client.Client, err error) { h.closed <- err }
+
+// serveRaw 启动只接受一个连接的裸 TCP 服务端，连接建立后写入 data。
+func serveRaw(t *testing.T, data []byte) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		nc, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = nc.Write(data)
+		// 保持连接，关闭只能由客户端发起
+		t.Cleanup(func() { nc.Close() })
+	}()
+	return ln.Addr().String()
+}
+
+// TestParseErrorCloses 校验任何解析错误都关闭连接，其后的帧不再交付。
+func TestParseErrorCloses(t *testing.T) {
+	enc, _ := protocol.NewEncoder()
+	good, _ := enc.EncodeSingle(1, []byte("ok"), false)
+	corrupt, _ := enc.AppendFrame(nil, 2, []byte("not a compressed block"), true, false)
+	huge, _ := protocol.AppendLenFlags(nil, 32<<20+1, false, false)
+	big, _ := enc.AppendSingle(nil, 3, make([]byte, 1025), 0)
+	for _, tc := range []struct {
+		name  string
+		cfg   client.Config
+		frame []byte
+		want  error
+	}{
+		{"corrupt", client.Config{}, corrupt, nil},
+		{"default frame limit", client.Config{}, huge, protocol.ErrFrameTooLarge},
+		{"frame limit", client.Config{MaxFrameSize: 1024}, big, protocol.ErrFrameTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := append(append(append([]byte(nil), good...), tc.frame...), good...)
+			addr := serveRaw(t, data)
+			h := newCloseHandler()
+			if _, err := client.DialConfig("tcp", addr, tc.cfg, h); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case err := <-h.closed:
+				if err == nil || tc.want != nil && !errors.Is(err, tc.want) {
+					t.Fatalf("OnClose err = %v, want %v", err, tc.want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("connection not closed")
+			}
+			if len(h.recv) != 1 {
+				t.Fatalf("delivered %d messages, want only the one before the bad frame", len(h.recv))
+			}
+		})
+	}
+}
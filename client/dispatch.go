@@ -0,0 +1,43 @@
+package client
+
+import (
+	"log"
+
+	"github.com/legamerdc/gio/protocol"
+)
+
+// Dispatcher 将消息按 api 解码为 protocol.Registry 中登记的类型，交给以 Handle 登记的处理函数；
+// 嵌入 Handler 实现即可作为其 OnMessage。
+type Dispatcher struct {
+	d *protocol.Dispatcher[*Client]
+	// OnError 在 api 未登记（protocol.ErrUnknownApi）或解码失败时调用，缺省记录日志
+	OnError func(c *Client, api uint16, err error)
+}
+
+func NewDispatcher(reg *protocol.Registry) *Dispatcher {
+	return &Dispatcher{d: protocol.NewDispatcher[*Client](reg)}
+}
+
+// Handle 为 T 登记处理函数，T 须已在 d 的 Registry 中登记；处理函数在读 goroutine 中同步调用。
+func Handle[T any](d *Dispatcher, fn func(c *Client, m *T)) error {
+	return protocol.Handle(d.d, fn)
+}
+
+// Registry 返回分发所用的登记表。
+func (d *Dispatcher) Registry() *protocol.Registry { return d.d.Registry() }
+
+// Dispatch 解码 msg 并调用 api 的处理函数，见 protocol.Dispatcher.Dispatch。
+func (d *Dispatcher) Dispatch(c *Client, api uint16, msg []byte) error {
+	return d.d.Dispatch(c, api, msg)
+}
+
+// OnMessage 实现 Handler.OnMessage。
+func (d *Dispatcher) OnMessage(c *Client, api uint16, msg []byte) {
+	if err := d.d.Dispatch(c, api, msg); err != nil {
+		if d.OnError != nil {
+			d.OnError(c, api, err)
+		} else {
+			log.Printf("client: dispatch error: %v", err)
+		}
+	}
+}
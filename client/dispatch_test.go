@@ -0,0 +1,68 @@
+package client_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/legamerdc/gio/client"
+	"github.com/legamerdc/gio/protocol"
+)
+
+type chatMsg struct {
+	Text string `json:"text"`
+}
+
+// dispatchHandler 以嵌入的 Dispatcher 作为 OnMessage。
+type dispatchHandler struct{ *client.Dispatcher }
+
+func (dispatchHandler) OnOpen(c *client.Client) {}
+
+func (dispatchHandler) OnClose(c *client.Client, err error) {}
+
+// TestDispatcher 校验按到达顺序分发类型化消息，未登记 api 与解码失败交给 OnError 且不中断后续消息。
+func TestDispatcher(t *testing.T) {
+	reg := protocol.NewRegistry()
+	if err := protocol.Register(reg, 10, protocol.JSON[chatMsg]()); err != nil {
+		t.Fatal(err)
+	}
+	h := dispatchHandler{client.NewDispatcher(reg)}
+	got := make(chan string, 4)
+	errs := make(chan uint16, 4)
+	h.OnError = func(c *client.Client, api uint16, err error) {
+		if api == 99 && !errors.Is(err, protocol.ErrUnknownApi) {
+			t.Errorf("api 99: err=%v, want ErrUnknownApi", err)
+		}
+		errs <- api
+	}
+	if err := client.Handle(h.Dispatcher, func(c *client.Client, m *chatMsg) { got <- m.Text }); err != nil {
+		t.Fatal(err)
+	}
+
+	enc, _ := protocol.NewEncoder()
+	var data []byte
+	for _, m := range []struct {
+		api uint16
+		msg string
+	}{{10, `{"text":"a"}`}, {99, ""}, {10, "{bad"}, {10, `{"text":"b"}`}} {
+		data, _ = enc.AppendSingle(data, m.api, []byte(m.msg), 0)
+	}
+	c, err := client.Dial("tcp", serveRaw(t, data), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, want := range []string{"a", "b"} {
+		select {
+		case s := <-got:
+			if s != want {
+				t.Fatalf("got %q, want %q", s, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("message %q not dispatched", want)
+		}
+	}
+	if len(errs) != 2 || <-errs != 99 || <-errs != 10 {
+		t.Fatal("dispatch errors not reported in order")
+	}
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/legamerdc/gio/internal/handshake"
+	"github.com/legamerdc/gio/protocol"
+)
+
+// handshake 在启动读循环前同步完成密钥交换；ServerHello 之后已到达的字节留在 rb 中交给读循环。
+func (c *Client) handshake() error {
+	timeout := c.cfg.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = defaultHandshakeTimeout
+	}
+	_ = c.conn.SetDeadline(time.Now().Add(timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	hs, hello, err := handshake.NewClient(handshake.ClientParams{
+		Pin:           c.cfg.ServerKey,
+		AEAD:          c.cfg.FrameAEAD,
+		Offer:         true,
+		Compression:   c.cfg.CompressionAlgo,
+		ContextWindow: c.contextWindow(),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrHandshakeFailed, err)
+	}
+	if err := c.writeControl(protocol.ApiHandshake, hello); err != nil {
+		return handshakeErr(err)
+	}
+	reply, err := c.readHandshake()
+	if err != nil {
+		return handshakeErr(err)
+	}
+	finished, res, err := hs.HandleServerHello(reply)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrHandshakeFailed, err)
+	}
+	if c.cfg.FrameAEAD && !res.AEAD {
+		return fmt.Errorf("%w: server declined frame authentication", ErrHandshakeFailed)
+	}
+	comp, err := protocol.LookupCompressor(res.Compression)
+	if err != nil {
+		return fmt.Errorf("%w: compression %q: %w", ErrHandshakeFailed, res.Compression, err)
+	}
+	if ki, ok := c.cfg.Cipher.(KeyInstaller); ok {
+		if err := ki.InstallKeys(res.Secret, res.Salt); err != nil {
+			return fmt.Errorf("%w: %w", ErrHandshakeFailed, err)
+		}
+	}
+	if err := c.writeControl(protocol.ApiHandshake, finished); err != nil {
+		return handshakeErr(err)
+	}
+	if res.AEAD {
+		// Finished 之后双方的帧均密封
+		tx, rx, err := res.FrameAEADs(false)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrHandshakeFailed, err)
+		}
+		c.prs.SetAEAD(rx)
+		c.mu.Lock()
+		c.txAEAD = tx
+		c.mu.Unlock()
+	}
+	c.prs.SetCompressor(comp)
+	c.mu.Lock()
+	c.enc.SetCompressor(comp)
+	c.mu.Unlock()
+	if res.ContextWindow > 0 {
+		c.setContext(res.ContextWindow)
+	}
+	return nil
+}
+
+// readHandshake 读取服务端的下一条握手消息；在此之前收到的其他帧均视为握手失败。
+func (c *Client) readHandshake() ([]byte, error) {
+	buf := make([]byte, 4<<10)
+	for {
+		var reply []byte
+		n, err := c.prs.ParseFrame(c.rb, func(api uint16, payload []byte) error {
+			if api != protocol.ApiHandshake {
+				return handshake.ErrUnexpected
+			}
+			reply = append([]byte(nil), payload...)
+			return nil
+		})
+		c.rb = c.rb[n:]
+		if err != nil || reply != nil {
+			return reply, err
+		}
+		m, err := c.conn.Read(buf)
+		c.rb = append(c.rb, buf[:m]...)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// dialTLS 在 nc 上完成 TLS 握手；未设置 ServerName 时取自 address。
+func dialTLS(nc net.Conn, address string, cfg Config) (net.Conn, error) {
+	tc := cfg.TLS
+	if tc.ServerName == "" {
+		tc = tc.Clone()
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			tc.ServerName = host
+		}
+	}
+	timeout := cfg.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = defaultHandshakeTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn := tls.Client(nc, tc)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		_ = nc.Close()
+		if ctx.Err() != nil {
+			return nil, ErrHandshakeTimeout
+		}
+		return nil, fmt.Errorf("%w: %w", ErrHandshakeFailed, err)
+	}
+	return conn, nil
+}
+
+func handshakeErr(err error) error {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return ErrHandshakeTimeout
+	}
+	return fmt.Errorf("%w: %w", ErrHandshakeFailed, err)
+}
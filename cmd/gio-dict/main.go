@@ -0,0 +1,174 @@
+// gio-dict 由抓取的消息负载样本训练 zstd 字典，供 protocol.NewDictCompressor 使用。
+//
+// 用法：
+//
+//	gio-dict -o chat.dict -id 7 [-size 65536] [-level better] 样本文件或目录...
+//	gio-dict -o chat.dict -id 7 -frames [-api 100-199] [-algo zstd | -dicts a.dict,b.dict] 抓包文件...
+//
+// 缺省每个文件为一条样本（目录递归读取）；-frames 时每个文件为一段线路字节流
+// （未经 AEAD/TLS 的连续帧），解出的每条业务消息为一条样本，-api 只取该区间的消息。
+// 抓包来自使用字典组的连接时，以 -dicts 给出该组的字典文件用于解压。
+// 训练后输出字典大小，以及样本逐条压缩时不用与使用字典的总字节数。
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+	"github.com/legamerdc/gio/protocol"
+)
+
+func main() {
+	var (
+		out    = flag.String("o", "", "输出字典文件（必填）")
+		id     = flag.Uint("id", 0, "字典 ID（写入每个压缩帧头，须非 0 且在字典组内唯一；0 表示随机）")
+		size   = flag.Int("size", 64<<10, "字典最大字节数")
+		level  = flag.String("level", "default", "目标压缩级别：fastest|default|better|best")
+		frames = flag.Bool("frames", false, "输入为抓取的帧流，按消息取样本")
+		apis   = flag.String("api", "", "与 -frames 同用：只取 api 落在 lo-hi 区间内的消息")
+		algo   = flag.String("algo", protocol.DefaultCompression, "与 -frames 同用：帧流中压缩帧所用的算法")
+		dicts  = flag.String("dicts", "", "与 -frames 同用：帧流所用字典组的字典文件（逗号分隔），优先于 -algo")
+	)
+	flag.Parse()
+	if *out == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	ok, lvl := zstd.EncoderLevelFromString(*level)
+	if !ok {
+		log.Fatalf("gio-dict: unknown level %q", *level)
+	}
+	lo, hi, err := parseRange(*apis)
+	if err != nil {
+		log.Fatalf("gio-dict: %v", err)
+	}
+	comp, err := captureCompressor(*algo, *dicts)
+	if err != nil {
+		log.Fatalf("gio-dict: %v", err)
+	}
+	var samples [][]byte
+	for _, root := range flag.Args() {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if !*frames {
+				samples = append(samples, b)
+				return nil
+			}
+			msgs, err := parseFrames(b, comp, lo, hi)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			samples = append(samples, msgs...)
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("gio-dict: %v", err)
+		}
+	}
+	if len(samples) == 0 {
+		log.Fatal("gio-dict: no samples")
+	}
+	d, err := dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: *size,
+		HashBytes:   6,
+		ZstdDictID:  uint32(*id),
+		ZstdLevel:   lvl,
+	})
+	if err != nil {
+		log.Fatalf("gio-dict: %v", err)
+	}
+	if err := os.WriteFile(*out, d, 0o644); err != nil {
+		log.Fatalf("gio-dict: %v", err)
+	}
+	info, _ := zstd.InspectDictionary(d)
+	plain, withDict, raw := measure(samples, d, lvl)
+	fmt.Printf("dict id=%d size=%d samples=%d\n", info.ID(), len(d), len(samples))
+	fmt.Printf("raw=%d plain=%d (%.1f%%) dict=%d (%.1f%%)\n",
+		raw, plain, pct(plain, raw), withDict, pct(withDict, raw))
+}
+
+// parseRange 解析 "lo-hi" 或单个 api，空串表示全部业务 api。
+func parseRange(s string) (lo, hi uint16, _ error) {
+	if s == "" {
+		return 0, 0xFFFF, nil
+	}
+	a, b, found := strings.Cut(s, "-")
+	if !found {
+		b = a
+	}
+	l, err1 := strconv.ParseUint(a, 0, 16)
+	h, err2 := strconv.ParseUint(b, 0, 16)
+	if err1 != nil || err2 != nil || l > h {
+		return 0, 0, fmt.Errorf("invalid api range %q", s)
+	}
+	return uint16(l), uint16(h), nil
+}
+
+// captureCompressor 返回解压抓包所用的算法：给出字典文件时以其组成字典组，否则按名查找。
+func captureCompressor(algo, dicts string) (protocol.Compressor, error) {
+	if dicts == "" {
+		return protocol.LookupCompressor(algo)
+	}
+	var ds []protocol.Dict
+	for _, path := range strings.Split(dicts, ",") {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, protocol.Dict{Data: b})
+	}
+	return protocol.NewDictCompressor(0, zstd.SpeedDefault, ds...)
+}
+
+// parseFrames 解出帧流中 api ∈ [lo, hi] 的业务消息，末尾不完整的帧忽略。
+func parseFrames(b []byte, comp protocol.Compressor, lo, hi uint16) ([][]byte, error) {
+	prs, _ := protocol.NewParser()
+	defer prs.Close()
+	prs.SetCompressor(comp)
+	var msgs [][]byte
+	_, err := prs.Parse(b, func(api uint16, p []byte) error {
+		if !protocol.IsControl(api) && api >= lo && api <= hi && len(p) > 0 {
+			msgs = append(msgs, append([]byte(nil), p...))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, protocol.ErrIncomplete) {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// measure 逐条压缩样本，返回不用字典、使用字典的压缩后总字节数与原始总字节数。
+func measure(samples [][]byte, d []byte, lvl zstd.EncoderLevel) (plain, withDict, raw int) {
+	pe, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(lvl))
+	de, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(lvl), zstd.WithEncoderDict(d))
+	if err != nil {
+		log.Fatalf("gio-dict: %v", err)
+	}
+	var buf []byte
+	for _, s := range samples {
+		raw += len(s)
+		buf = pe.EncodeAll(s, buf[:0])
+		plain += len(buf)
+		buf = de.EncodeAll(s, buf[:0])
+		withDict += len(buf)
+	}
+	return plain, withDict, raw
+}
+
+func pct(n, of int) float64 { return 100 * float64(n) / float64(of) }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+	"github.com/legamerdc/gio/protocol"
+)
+
+func TestParseRange(t *testing.T) {
+	for _, tc := range []struct {
+		in     string
+		lo, hi uint16
+		ok     bool
+	}{
+		{"", 0, 0xFFFF, true},
+		{"100-199", 100, 199, true},
+		{"7", 7, 7, true},
+		{"0x10-0x1f", 16, 31, true},
+		{"200-100", 0, 0, false},
+		{"1-70000", 0, 0, false},
+		{"a-b", 0, 0, false},
+	} {
+		lo, hi, err := parseRange(tc.in)
+		if (err == nil) != tc.ok || lo != tc.lo || hi != tc.hi {
+			t.Errorf("parseRange(%q) = %d, %d, %v", tc.in, lo, hi, err)
+		}
+	}
+}
+
+// TestParseFrames 校验以字典文件组成的字典组解出抓包中的消息、按 api 区间过滤并忽略末尾的半帧，
+// 缺少抓包所用字典时返回错误。
+func TestParseFrames(t *testing.T) {
+	var samples [][]byte
+	for i := range 300 {
+		samples = append(samples, fmt.Appendf(nil, `{"op":"move","id":%d,"x":%d,"y":%d}`, i*7919, i%640, i%480))
+	}
+	d, err := dict.BuildZstdDict(samples, dict.Options{MaxDictSize: 4 << 10, HashBytes: 6, ZstdDictID: 9, ZstdLevel: zstd.SpeedDefault})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "move.dict")
+	if err := os.WriteFile(path, d, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sender, err := protocol.NewDictCompressor(1, zstd.SpeedDefault, protocol.Dict{Lo: 0, Hi: 0xFEFF, Data: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := protocol.NewEncoder()
+	enc.SetCompressor(sender)
+	var capture []byte
+	for i, api := range []uint16{100, 5, 150, protocol.ApiPing} {
+		if capture, err = enc.AppendSingle(capture, api, samples[i], protocol.FlagCompress); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tail, _ := enc.AppendSingle(nil, 120, samples[9], protocol.FlagCompress)
+	capture = append(capture, tail[:len(tail)-1]...)
+
+	comp, err := captureCompressor("", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := parseFrames(capture, comp, 100, 199)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]byte{samples[0], samples[2]}; !slices.EqualFunc(msgs, want, func(a, b []byte) bool { return string(a) == string(b) }) {
+		t.Fatalf("got %q, want %q", msgs, want)
+	}
+
+	plain, _ := captureCompressor("zstd", "")
+	if _, err := parseFrames(capture, plain, 0, 0xFFFF); err == nil {
+		t.Fatal("capture decoded without its dictionary")
+	}
+}
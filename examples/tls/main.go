@@ -0,0 +1,126 @@
+// tls 示例：同一进程内以临时自签名证书在回环地址上启动 TLS 服务端，
+// 客户端信任该证书后往返回显，校验 OnMessage 收到的是明文（含大于单条 TLS 记录的消息）。
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/legamerdc/gio/client"
+	"github.com/legamerdc/gio/server"
+)
+
+type nopCipher struct{}
+
+func (nopCipher) EncryptInPlace(p []byte) {}
+func (nopCipher) DecryptInPlace(p []byte) {}
+
+const apiEcho uint16 = 1
+
+type echoHandler struct{}
+
+func (echoHandler) OnOpen(c *server.Conn[nopCipher]) {}
+
+func (echoHandler) OnMessage(c *server.Conn[nopCipher], api uint16, msg []byte) (async bool) {
+	_ = c.Write(msg, api, server.Compress)
+	return false
+}
+
+func (echoHandler) OnClose(c *server.Conn[nopCipher], err error) {}
+
+type clientHandler struct{ recv chan []byte }
+
+func (clientHandler) OnOpen(c *client.Client) {}
+
+func (h clientHandler) OnMessage(c *client.Client, api uint16, msg []byte) {
+	h.recv <- append([]byte(nil), msg...)
+}
+
+func (clientHandler) OnClose(c *client.Client, err error) {}
+
+// selfSigned 生成仅对 127.0.0.1 有效的自签名证书。
+func selfSigned() (tls.Certificate, *x509.CertPool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gio example"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool, nil
+}
+
+func main() {
+	cert, pool, err := selfSigned()
+	if err != nil {
+		log.Fatal(err)
+	}
+	const addr = "127.0.0.1:18892"
+	cfg := server.Config[nopCipher]{
+		NumPollers:    2,
+		ListenNetwork: "tcp",
+		ListenAddress: addr,
+		ReusePort:     true,
+		TLS:           &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+	srv, err := server.Start[nopCipher](cfg, echoHandler{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer srv.Stop(context.Background())
+
+	for i := 0; i < 4; i++ {
+		h := clientHandler{recv: make(chan []byte, 1)}
+		c, err := client.DialConfig("tcp", addr, client.Config{TLS: &tls.Config{RootCAs: pool}}, h)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for j := 0; j < 20; j++ {
+			msg := bytes.Repeat([]byte{byte(j)}, 1+j*3000)
+			if err := c.Write(apiEcho, msg); err != nil {
+				log.Fatal(err)
+			}
+			select {
+			case got := <-h.recv:
+				if !bytes.Equal(got, msg) {
+					log.Fatalf("client %d message %d mismatch", i, j)
+				}
+			case <-time.After(time.Second):
+				log.Fatalf("client %d message %d timeout", i, j)
+			}
+		}
+		_ = c.Close()
+	}
+	fmt.Println("tls: ok")
+
+	// 未信任该证书的客户端应握手失败
+	_, err = client.DialConfig("tcp", addr, client.Config{TLS: &tls.Config{}}, clientHandler{})
+	fmt.Println("untrusted:", err)
+}
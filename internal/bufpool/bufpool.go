@@ -0,0 +1,65 @@
+package bufpool
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// 尺寸分级：2^minShift .. 2^maxShift，超出上限的申请直接走堆分配且不回收。
+const (
+	minShift   = 6  // 64B
+	maxShift   = 24 // 16MiB
+	numClasses = maxShift - minShift + 1
+	maxFree    = 64 // 每级最多缓存的空闲块数
+)
+
+// Pool 是按 2^k 尺寸分级的字节池（design.md: bytesPool）。
+// 每级为一个受互斥锁保护的空闲栈，稳态下 Get/Put 无堆分配；可跨 goroutine 使用。
+type Pool struct {
+	mu   sync.Mutex
+	free [numClasses][][]byte
+}
+
+func New() *Pool { return &Pool{} }
+
+func classOf(n int) int {
+	if n <= 1<<minShift {
+		return 0
+	}
+	return bits.Len(uint(n-1)) - minShift
+}
+
+// Get 返回长度为 n、容量为不小于 n 的最近 2^k 的切片。
+func (p *Pool) Get(n int) []byte {
+	k := classOf(n)
+	if k >= numClasses {
+		return make([]byte, n)
+	}
+	p.mu.Lock()
+	if l := len(p.free[k]); l > 0 {
+		b := p.free[k][l-1]
+		p.free[k][l-1] = nil
+		p.free[k] = p.free[k][:l-1]
+		p.mu.Unlock()
+		return b[:n]
+	}
+	p.mu.Unlock()
+	return make([]byte, n, 1<<(k+minShift))
+}
+
+// Put 归还由 Get 取得的切片；容量不是分级尺寸的切片被直接丢弃。
+func (p *Pool) Put(b []byte) {
+	c := cap(b)
+	if c < 1<<minShift || c&(c-1) != 0 {
+		return
+	}
+	k := classOf(c)
+	if k >= numClasses {
+		return
+	}
+	p.mu.Lock()
+	if len(p.free[k]) < maxFree {
+		p.free[k] = append(p.free[k], b[:0])
+	}
+	p.mu.Unlock()
+}
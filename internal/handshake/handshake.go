@@ -0,0 +1,385 @@
+// Package handshake 实现连接建立时的 X25519 密钥交换（服务端与客户端共用）：
+//
+//	ClientHello  = 1 | version | modes | ce(32) | [log2(窗口) 若 modes&ModeContext] | [n(1) | 压缩算法名(n)]
+//	ServerHello  = 2 | flags | se(32) | [S(32) 若 flags&FlagStatic] | [log2(窗口) 若 flags&FlagContext]
+//	               | [n(1) | 压缩算法名(n) 若 flags&FlagCompression] | serverMAC(32)
+//	Finished     = 3 | clientMAC(32)
+//
+// ce/se 为双方临时公钥，S 为可选的服务端静态公钥。共享秘密
+// ikm = DH(ce,se) [|| DH(ce,S)]，转录哈希 th = SHA256(ClientHello || ServerHello 去掉 MAC)，
+// 以 HKDF(ikm, th) 派生连接秘密与双方确认 MAC 的密钥。
+// 客户端固定（pin）了服务端静态公钥时，只有持有对应私钥的服务端才能算出正确的 serverMAC。
+// modes 为客户端支持的帧认证模式，服务端以 flags&FlagAEAD 给出选择，二者均计入转录哈希。
+// 客户端可附带提议的压缩算法名（可为空，表示由服务端决定），服务端此时以 FlagCompression
+// 回复选定的算法，其后 Compressed 帧均以该算法压缩（见 protocol.Compressor）。
+// 客户端以 ModeContext 提议上下文接管及其最大窗口，服务端以 FlagContext 给出不超过它的窗口。
+package handshake
+
+import (
+	"crypto/aes"
+	stdcipher "crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+
+	"github.com/legamerdc/gio/cipher"
+	"github.com/legamerdc/gio/protocol"
+)
+
+const (
+	msgClientHello = 1
+	msgServerHello = 2
+	msgFinished    = 3
+
+	version = 1
+	keyLen  = 32
+	macLen  = sha256.Size
+
+	// FlagStatic 表示 ServerHello 携带服务端静态公钥。
+	FlagStatic = 1 << 0
+	// FlagAEAD 表示服务端选择了帧级 AES-256-GCM 认证（见 protocol.FrameAEAD）。
+	FlagAEAD = 1 << 1
+	// FlagCompression 表示 ServerHello 携带选定的压缩算法名。
+	FlagCompression = 1 << 2
+	// FlagContext 表示服务端接受上下文接管，ServerHello 携带选定的窗口。
+	FlagContext = 1 << 3
+
+	// ModeAESGCM 为 ClientHello 中支持 AES-256-GCM 帧认证的位。
+	ModeAESGCM = 1 << 0
+	// ModeContext 为 ClientHello 中提议上下文接管（见 protocol.Encoder.SetContext）的位。
+	ModeContext = 1 << 1
+)
+
+var (
+	ErrMalformed  = errors.New("handshake: malformed message")
+	ErrVersion    = errors.New("handshake: unsupported version")
+	ErrServerKey  = errors.New("handshake: server static key mismatch")
+	ErrBadMAC     = errors.New("handshake: key confirmation failed")
+	ErrUnexpected = errors.New("handshake: unexpected message")
+)
+
+// Result 为握手派生的连接秘密，交给 Cipher 的 InstallKeys；AEAD 表示协商启用了帧认证，
+// Compression 为协商的压缩算法名（客户端未提议时为空，双方沿用各自的配置），
+// ContextWindow 为协商的上下文接管窗口（0 表示不启用）。
+type Result struct {
+	Secret        []byte
+	Salt          []byte
+	AEAD          bool
+	Compression   string
+	ContextWindow int
+}
+
+// ClientParams 为客户端握手参数：Pin 非 nil 时要求服务端出示该静态公钥，
+// AEAD 为 true 时提议帧级认证，Offer 为 true 时提议压缩算法 Compression（可为空），
+// ContextWindow >0 时提议以不超过它的窗口启用上下文接管。
+type ClientParams struct {
+	Pin           *ecdh.PublicKey
+	AEAD          bool
+	Offer         bool
+	Compression   string
+	ContextWindow int
+}
+
+// ServerParams 为服务端握手参数：Static 为可选的服务端静态私钥，AEAD 为 true 时接受
+// 客户端提议的帧级认证，SelectCompression 由客户端提议的算法名选定实际使用的算法名，
+// SelectContext 由客户端提议的窗口选定不超过它的窗口（返回 0 拒绝，nil 时总是拒绝）。
+type ServerParams struct {
+	Static            *ecdh.PrivateKey
+	AEAD              bool
+	SelectCompression func(offer string) string
+	SelectContext     func(offer int) int
+}
+
+// FrameAEADs 由连接秘密派生两个方向的帧认证状态，server 决定哪个方向用于发送。
+func (r Result) FrameAEADs(server bool) (tx, rx *protocol.FrameAEAD, _ error) {
+	c2s, err := frameAEAD(r, "gio frame c2s")
+	if err != nil {
+		return nil, nil, err
+	}
+	s2c, err := frameAEAD(r, "gio frame s2c")
+	if err != nil {
+		return nil, nil, err
+	}
+	if server {
+		return s2c, c2s, nil
+	}
+	return c2s, s2c, nil
+}
+
+func frameAEAD(r Result, label string) (*protocol.FrameAEAD, error) {
+	okm := cipher.HKDF(r.Secret, r.Salt, []byte(label), keyLen+12)
+	b, err := aes.NewCipher(okm[:keyLen])
+	if err != nil {
+		return nil, err
+	}
+	g, err := stdcipher.NewGCM(b)
+	if err != nil {
+		return nil, err
+	}
+	return protocol.NewFrameAEAD(g, okm[keyLen:])
+}
+
+// Client 为客户端握手状态。
+type Client struct {
+	priv  *ecdh.PrivateKey
+	pin   *ecdh.PublicKey
+	offer bool
+	hello []byte
+}
+
+// NewClient 生成临时密钥并返回 ClientHello。
+func NewClient(p ClientParams) (*Client, []byte, error) {
+	if len(p.Compression) > maxNameLen || (p.ContextWindow > 0 && !protocol.ValidContextWindow(p.ContextWindow)) {
+		return nil, nil, ErrMalformed
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	var modes byte
+	if p.AEAD {
+		modes |= ModeAESGCM
+	}
+	if p.ContextWindow > 0 {
+		modes |= ModeContext
+	}
+	hello := append([]byte{msgClientHello, version, modes}, priv.PublicKey().Bytes()...)
+	if p.ContextWindow > 0 {
+		hello = append(hello, byte(bits.TrailingZeros(uint(p.ContextWindow))))
+	}
+	if p.Offer {
+		hello = appendName(hello, p.Compression)
+	}
+	return &Client{priv: priv, pin: p.Pin, offer: p.Offer, hello: hello}, hello, nil
+}
+
+// HandleServerHello 校验 ServerHello，返回 Finished 消息与派生的连接秘密。
+func (c *Client) HandleServerHello(msg []byte) (finished []byte, _ Result, _ error) {
+	if len(msg) < 2+keyLen+macLen || msg[0] != msgServerHello {
+		return nil, Result{}, ErrUnexpected
+	}
+	flags := msg[1]
+	if flags&FlagAEAD != 0 && c.hello[2]&ModeAESGCM == 0 {
+		return nil, Result{}, ErrMalformed
+	}
+	body := msg[:len(msg)-macLen]
+	mac := msg[len(msg)-macLen:]
+	if flags&FlagCompression != 0 && !c.offer {
+		return nil, Result{}, ErrMalformed
+	}
+	if flags&FlagContext != 0 && c.hello[2]&ModeContext == 0 {
+		return nil, Result{}, ErrMalformed
+	}
+	want := 2 + keyLen
+	if flags&FlagStatic != 0 {
+		want += keyLen
+	}
+	var window int
+	if flags&FlagContext != 0 {
+		if len(body) <= want {
+			return nil, Result{}, ErrMalformed
+		}
+		// 服务端选定的窗口不得超过提议
+		var ok bool
+		if window, ok = readWindow(body[want]); !ok || body[want] > c.hello[3+keyLen] {
+			return nil, Result{}, ErrMalformed
+		}
+		want++
+	}
+	var name string
+	if flags&FlagCompression != 0 {
+		var ok bool
+		if name, ok = readName(body[min(want, len(body)):]); !ok {
+			return nil, Result{}, ErrMalformed
+		}
+		want += 1 + len(name)
+	}
+	if len(body) != want {
+		return nil, Result{}, ErrMalformed
+	}
+	se, err := ecdh.X25519().NewPublicKey(body[2 : 2+keyLen])
+	if err != nil {
+		return nil, Result{}, ErrMalformed
+	}
+	ikm, err := c.priv.ECDH(se)
+	if err != nil {
+		return nil, Result{}, err
+	}
+	if flags&FlagStatic != 0 {
+		sp, err := ecdh.X25519().NewPublicKey(body[2+keyLen : 2+2*keyLen])
+		if err != nil {
+			return nil, Result{}, ErrMalformed
+		}
+		if c.pin != nil && !c.pin.Equal(sp) {
+			return nil, Result{}, ErrServerKey
+		}
+		dh, err := c.priv.ECDH(sp)
+		if err != nil {
+			return nil, Result{}, err
+		}
+		ikm = append(ikm, dh...)
+	} else if c.pin != nil {
+		return nil, Result{}, ErrServerKey
+	}
+	ks := schedule(ikm, c.hello, body)
+	if !hmac.Equal(mac, ks.serverMAC) {
+		return nil, Result{}, ErrBadMAC
+	}
+	ks.res.AEAD = flags&FlagAEAD != 0
+	ks.res.Compression = name
+	ks.res.ContextWindow = window
+	return append([]byte{msgFinished}, ks.clientMAC...), ks.res, nil
+}
+
+// Server 为服务端握手状态。
+type Server struct {
+	ks keySchedule
+}
+
+// NewServer 处理 ClientHello，返回 ServerHello。
+func NewServer(p ServerParams, hello []byte) (*Server, []byte, error) {
+	if len(hello) < 2 || hello[0] != msgClientHello {
+		return nil, nil, ErrUnexpected
+	}
+	if hello[1] != version {
+		return nil, nil, ErrVersion
+	}
+	if len(hello) < 3+keyLen {
+		return nil, nil, ErrMalformed
+	}
+	rest := hello[3+keyLen:]
+	var offerWindow int
+	if hello[2]&ModeContext != 0 {
+		var ok bool
+		if len(rest) == 0 {
+			return nil, nil, ErrMalformed
+		}
+		if offerWindow, ok = readWindow(rest[0]); !ok {
+			return nil, nil, ErrMalformed
+		}
+		rest = rest[1:]
+	}
+	offered := len(rest) > 0
+	var offer string
+	if offered {
+		var ok bool
+		if offer, ok = readName(rest); !ok || len(rest) != 1+len(offer) {
+			return nil, nil, ErrMalformed
+		}
+	}
+	ce, err := ecdh.X25519().NewPublicKey(hello[3 : 3+keyLen])
+	if err != nil {
+		return nil, nil, ErrMalformed
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	ikm, err := priv.ECDH(ce)
+	if err != nil {
+		return nil, nil, err
+	}
+	body := append([]byte{msgServerHello, 0}, priv.PublicKey().Bytes()...)
+	if p.Static != nil {
+		dh, err := p.Static.ECDH(ce)
+		if err != nil {
+			return nil, nil, err
+		}
+		ikm = append(ikm, dh...)
+		body[1] |= FlagStatic
+		body = append(body, p.Static.PublicKey().Bytes()...)
+	}
+	if p.AEAD && hello[2]&ModeAESGCM != 0 {
+		body[1] |= FlagAEAD
+	}
+	var window int
+	if offerWindow > 0 && p.SelectContext != nil {
+		if window = p.SelectContext(offerWindow); window > offerWindow || (window > 0 && !protocol.ValidContextWindow(window)) {
+			window = 0
+		}
+	}
+	if window > 0 {
+		body[1] |= FlagContext
+		body = append(body, byte(bits.TrailingZeros(uint(window))))
+	}
+	var name string
+	if offered {
+		name = offer
+		if p.SelectCompression != nil {
+			name = p.SelectCompression(offer)
+		}
+		if len(name) > maxNameLen {
+			return nil, nil, ErrMalformed
+		}
+		body[1] |= FlagCompression
+		body = appendName(body, name)
+	}
+	s := &Server{ks: schedule(ikm, hello, body)}
+	s.ks.res.AEAD = body[1]&FlagAEAD != 0
+	s.ks.res.Compression = name
+	s.ks.res.ContextWindow = window
+	return s, append(body, s.ks.serverMAC...), nil
+}
+
+// HandleFinished 校验客户端的 Finished，成功时返回派生的连接秘密。
+func (s *Server) HandleFinished(msg []byte) (Result, error) {
+	if len(msg) != 1+macLen || msg[0] != msgFinished {
+		return Result{}, ErrUnexpected
+	}
+	if !hmac.Equal(msg[1:], s.ks.clientMAC) {
+		return Result{}, ErrBadMAC
+	}
+	return s.ks.res, nil
+}
+
+// maxNameLen 为压缩算法名的最大长度（单字节长度前缀）。
+const maxNameLen = 255
+
+func appendName(b []byte, name string) []byte {
+	return append(append(b, byte(len(name))), name...)
+}
+
+// readName 读取长度前缀的算法名，b 不足时返回 false。
+func readName(b []byte) (string, bool) {
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return "", false
+	}
+	return string(b[1 : 1+int(b[0])]), true
+}
+
+// readWindow 将 log2 编码的窗口还原为字节数。
+func readWindow(b byte) (int, bool) {
+	if b >= 32 {
+		return 0, false
+	}
+	w := 1 << b
+	return w, protocol.ValidContextWindow(w)
+}
+
+type keySchedule struct {
+	res       Result
+	serverMAC []byte
+	clientMAC []byte
+}
+
+func schedule(ikm, clientHello, serverHello []byte) keySchedule {
+	h := sha256.New()
+	h.Write(clientHello)
+	h.Write(serverHello)
+	th := h.Sum(nil)
+	okm := cipher.HKDF(ikm, th, []byte("gio handshake"), 3*keyLen)
+	return keySchedule{
+		res:       Result{Secret: okm[:keyLen], Salt: th},
+		serverMAC: confirm(okm[keyLen:2*keyLen], th),
+		clientMAC: confirm(okm[2*keyLen:], th),
+	}
+}
+
+func confirm(key, th []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write(th)
+	return m.Sum(nil)
+}
@@ -81,3 +81,44 @@ func (b *Buffer) Discard(n int) int {
 	b.readPos += n
 	return n
 }
+
+// Slices 返回可读数据的两段视图（不拷贝）；未回绕时第二段为空。
+// 视图在下一次 Write/Discard 前有效。
+func (b *Buffer) Slices() (first, second []byte) {
+	ln := b.Len()
+	if ln == 0 {
+		return nil, nil
+	}
+	start := b.readPos & b.mask
+	end := start + ln
+	if end <= len(b.buf) {
+		return b.buf[start:end], nil
+	}
+	return b.buf[start:], b.buf[:end-len(b.buf)]
+}
+
+// WritableSlice 返回从写指针起的连续空闲区，可直接作为 read(2) 的目标；
+// 写入后需调用 Commit 前进写指针。
+func (b *Buffer) WritableSlice() []byte {
+	free := b.Free()
+	if free == 0 {
+		return nil
+	}
+	start := b.writePos & b.mask
+	end := start + free
+	if end > len(b.buf) {
+		end = len(b.buf)
+	}
+	return b.buf[start:end]
+}
+
+// Commit 前进写指针 n 字节（n 不得超过 WritableSlice 的长度）。
+func (b *Buffer) Commit(n int) {
+	if n > b.Free() {
+		n = b.Free()
+	}
+	b.writePos += n
+}
+
+// Reset 清空缓冲。
+func (b *Buffer) Reset() { b.readPos, b.writePos = 0, 0 }
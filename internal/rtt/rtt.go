@@ -0,0 +1,41 @@
+package rtt
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Estimator 按 RFC 6298 维护平滑 RTT（srtt）与抖动（rttvar）：
+//
+//	rttvar = 3/4*rttvar + 1/4*|srtt - r|
+//	srtt   = 7/8*srtt   + 1/8*r
+//
+// Update 由单一 goroutine 调用，Get 可从任意 goroutine 读取。
+type Estimator struct {
+	srtt   atomic.Int64
+	rttvar atomic.Int64
+}
+
+func (e *Estimator) Update(sample time.Duration) {
+	if sample < 0 {
+		return
+	}
+	r := int64(sample)
+	srtt := e.srtt.Load()
+	if srtt == 0 {
+		e.srtt.Store(r)
+		e.rttvar.Store(r / 2)
+		return
+	}
+	d := srtt - r
+	if d < 0 {
+		d = -d
+	}
+	e.rttvar.Store((3*e.rttvar.Load() + d) / 4)
+	e.srtt.Store((7*srtt + r) / 8)
+}
+
+// Get 返回平滑 RTT 与抖动；尚无样本时均为 0。
+func (e *Estimator) Get() (srtt, jitter time.Duration) {
+	return time.Duration(e.srtt.Load()), time.Duration(e.rttvar.Load())
+}
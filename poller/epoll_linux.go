@@ -5,14 +5,15 @@ package poller
 import (
 	"errors"
 	"runtime"
+	"sync/atomic"
 
 	"golang.org/x/sys/unix"
 )
 
 type epollPoller struct {
 	efd   int
-	wfd   int // eventfd for wakeup
-	close bool
+	wfd   int          // eventfd for wakeup
+	state atomic.Int32 // pollerIdle / pollerRunning / pollerClosed
 }
 
 func New() (Poller, error) {
@@ -65,6 +66,13 @@ func (p *epollPoller) Unregister(fd FD) error {
 }
 
 func (p *epollPoller) Wake() error {
+	if p.state.Load() == pollerClosed {
+		return nil // fd 可能已释放，避免写入被复用的 fd
+	}
+	return p.wake()
+}
+
+func (p *epollPoller) wake() error {
 	var buf [8]byte
 	buf[0] = 1
 	_, err := unix.Write(p.wfd, buf[:])
@@ -74,18 +82,37 @@ func (p *epollPoller) Wake() error {
 	return err
 }
 
+// Close 通知事件循环在本轮结束后退出，可从任意 goroutine 调用。
 func (p *epollPoller) Close() error {
-	p.close = true
+	if p.state.CompareAndSwap(pollerIdle, pollerClosed) {
+		return p.release()
+	}
+	if p.state.CompareAndSwap(pollerRunning, pollerClosed) {
+		return p.wake()
+	}
+	return nil
+}
+
+func (p *epollPoller) release() error {
 	unix.Close(p.wfd)
 	return unix.Close(p.efd)
 }
 
 func (p *epollPoller) Run(h Handler) error {
 	defer runtime.KeepAlive(p)
+	if !p.state.CompareAndSwap(pollerIdle, pollerRunning) {
+		return nil
+	}
+	defer p.release()
 	events := make([]unix.EpollEvent, 1024)
 	var efdBuf [8]byte
-	for !p.close {
-		n, err := unix.EpollWait(p.efd, events, -1)
+	th, _ := h.(TimerHandler)
+	for p.state.Load() == pollerRunning {
+		timeout := -1
+		if th != nil {
+			timeout = timeoutMillis(th.NextTimeout())
+		}
+		n, err := unix.EpollWait(p.efd, events, timeout)
 		if err != nil {
 			if err == unix.EINTR {
 				continue
@@ -106,6 +133,7 @@ func (p *epollPoller) Run(h Handler) error {
 						return rerr
 					}
 				}
+				h.OnWake()
 				continue
 			}
 			if (ev.Events & (unix.EPOLLERR | unix.EPOLLHUP)) != 0 {
@@ -119,6 +147,9 @@ func (p *epollPoller) Run(h Handler) error {
 				h.OnWritable(fd)
 			}
 		}
+		if th != nil {
+			th.OnTimer()
+		}
 	}
 	return nil
 }
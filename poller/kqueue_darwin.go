@@ -6,15 +6,17 @@ import (
 	"errors"
 	"log"
 	"runtime"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
 
 type kqueuePoller struct {
 	kq    int
-	wfd   int // 写端，用于唤醒
-	rfd   int // 读端，注册到 kqueue
-	close bool
+	wfd   int          // 写端，用于唤醒
+	rfd   int          // 读端，注册到 kqueue
+	state atomic.Int32 // pollerIdle / pollerRunning / pollerClosed
 }
 
 func New() (Poller, error) {
@@ -87,6 +89,13 @@ func (p *kqueuePoller) Unregister(fd FD) error {
 }
 
 func (p *kqueuePoller) Wake() error {
+	if p.state.Load() == pollerClosed {
+		return nil // fd 可能已释放，避免写入被复用的 fd
+	}
+	return p.wake()
+}
+
+func (p *kqueuePoller) wake() error {
 	var b [1]byte
 	b[0] = 1
 	_, err := unix.Write(p.wfd, b[:])
@@ -96,8 +105,18 @@ func (p *kqueuePoller) Wake() error {
 	return err
 }
 
+// Close 通知事件循环在本轮结束后退出，可从任意 goroutine 调用。
 func (p *kqueuePoller) Close() error {
-	p.close = true
+	if p.state.CompareAndSwap(pollerIdle, pollerClosed) {
+		return p.release()
+	}
+	if p.state.CompareAndSwap(pollerRunning, pollerClosed) {
+		return p.wake()
+	}
+	return nil
+}
+
+func (p *kqueuePoller) release() error {
 	unix.Close(p.rfd)
 	unix.Close(p.wfd)
 	return unix.Close(p.kq)
@@ -105,10 +124,22 @@ func (p *kqueuePoller) Close() error {
 
 func (p *kqueuePoller) Run(h Handler) error {
 	defer runtime.KeepAlive(p)
+	if !p.state.CompareAndSwap(pollerIdle, pollerRunning) {
+		return nil
+	}
+	defer p.release()
 	events := make([]unix.Kevent_t, 1024)
 	buf := make([]byte, 16)
-	for !p.close {
-		n, err := unix.Kevent(p.kq, nil, events, nil)
+	th, _ := h.(TimerHandler)
+	for p.state.Load() == pollerRunning {
+		var ts *unix.Timespec
+		if th != nil {
+			if ms := timeoutMillis(th.NextTimeout()); ms >= 0 {
+				t := unix.NsecToTimespec(int64(ms) * int64(time.Millisecond))
+				ts = &t
+			}
+		}
+		n, err := unix.Kevent(p.kq, nil, events, ts)
 		if err != nil {
 			if err == unix.EINTR {
 				continue
@@ -128,6 +159,7 @@ func (p *kqueuePoller) Run(h Handler) error {
 						return rerr
 					}
 				}
+				h.OnWake()
 				continue
 			}
 			log.Printf("kqueue: event fd=%d filter=%d flags=0x%x fflags=0x%x data=%d", fd, ev.Filter, ev.Flags, ev.Fflags, ev.Data)
@@ -149,6 +181,9 @@ func (p *kqueuePoller) Run(h Handler) error {
 				h.OnClose(fd, errors.New("kqueue: eof"))
 			}
 		}
+		if th != nil {
+			th.OnTimer()
+		}
 	}
 	return nil
 }
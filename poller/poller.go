@@ -1,6 +1,9 @@
 package poller
 
-import "net"
+import (
+	"net"
+	"time"
+)
 
 // FD 表示文件描述符。
 type FD = int
@@ -12,8 +15,35 @@ type Handler interface {
 	OnReadable(fd FD)
 	OnWritable(fd FD)
 	OnClose(fd FD, err error)
+	// OnWake 在 Wake 唤醒后调用，用于处理跨 goroutine 投递到本 poller 的任务。
+	OnWake()
 }
 
+// TimerHandler 可由 Handler 额外实现，用于在事件循环内驱动定时器（无独立 goroutine）。
+// poller 每次等待前调用 NextTimeout 取得最长等待时间（<0 表示无限等待），
+// 每次等待返回（事件或超时）后调用 OnTimer。
+
+type TimerHandler interface {
+	NextTimeout() time.Duration
+	OnTimer()
+}
+
+// timeoutMillis 将等待时长向上取整为毫秒；<0 表示无限等待。
+func timeoutMillis(d time.Duration) int {
+	if d < 0 {
+		return -1
+	}
+	return int((d + time.Millisecond - 1) / time.Millisecond)
+}
+
+// poller 生命周期：Close 只通知事件循环退出，fd 由 Run 返回前释放；
+// 从未运行的 poller 在 Close 时直接释放。
+const (
+	pollerIdle int32 = iota
+	pollerRunning
+	pollerClosed
+)
+
 // Poller 提供注册/事件循环。
 
 type Poller interface {
@@ -0,0 +1,82 @@
+package protocol
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+)
+
+// 认证帧（AEAD 模式）：整帧头部之后的部分（非批量为 api+负载，批量为压缩体）
+// 整体密封为 密文 || tag，头部长度随之增加 tag 长度，其余长度规则不变；
+// 密封后的头部作为附加数据（AAD）。nonce 为每方向的 IV 与 8 字节隐式序号（BE）按位异或，
+// 序号从 0 起逐帧递增且不上线路：重放、乱序或丢帧都会导致校验失败。
+
+// ErrAuthFailed 表示认证帧校验失败（被篡改、重放或乱序）。
+var ErrAuthFailed = errors.New("protocol: frame authentication failed")
+
+var errNonceSize = errors.New("protocol: AEAD nonce size must be 12")
+
+const aeadNonceSize = 12
+
+// FrameAEAD 为单个方向的帧认证状态，非并发安全：发送方须按写出顺序串行调用 Seal，
+// 接收方由 Parser 按到达顺序校验。
+type FrameAEAD struct {
+	aead cipher.AEAD
+	iv   [aeadNonceSize]byte
+	seq  uint64
+	buf  [aeadNonceSize]byte
+	hdr  [MaxHeaderLen]byte
+}
+
+// NewFrameAEAD 以 aead（nonce 须为 12 字节，如 AES-GCM）与 12 字节 IV 创建帧认证状态。
+func NewFrameAEAD(aead cipher.AEAD, iv []byte) (*FrameAEAD, error) {
+	if aead.NonceSize() != aeadNonceSize || len(iv) != aeadNonceSize {
+		return nil, errNonceSize
+	}
+	a := &FrameAEAD{aead: aead}
+	copy(a.iv[:], iv)
+	return a, nil
+}
+
+// Overhead 返回每帧增加的字节数（tag 长度）。
+func (a *FrameAEAD) Overhead() int { return a.aead.Overhead() }
+
+func (a *FrameAEAD) nextNonce() []byte {
+	a.buf = a.iv
+	s := binary.BigEndian.Uint64(a.buf[4:]) ^ a.seq
+	binary.BigEndian.PutUint64(a.buf[4:], s)
+	a.seq++
+	return a.buf[:]
+}
+
+// Seal 将一个完整的明文帧密封为认证帧并追加到 dst；dst 容量足够时不分配内存。
+func (a *FrameAEAD) Seal(dst, frame []byte) ([]byte, error) {
+	c, length, compressed, batched, err := DecodeLenFlags(frame)
+	if err != nil {
+		return nil, err
+	}
+	body := frame[c:]
+	want := length
+	if !batched {
+		want += 2
+	}
+	if len(body) != want {
+		return nil, ErrIncomplete
+	}
+	hn, err := putHeader(&a.hdr, length+a.aead.Overhead(), compressed, batched)
+	if err != nil {
+		return nil, err
+	}
+	hdr := a.hdr[:hn]
+	dst = append(dst, hdr...)
+	return a.aead.Seal(dst, a.nextNonce(), body, hdr), nil
+}
+
+// open 原地校验并解密帧体，返回明文。
+func (a *FrameAEAD) open(hdr, body []byte) ([]byte, error) {
+	pt, err := a.aead.Open(body[:0], a.nextNonce(), body, hdr)
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	return pt, nil
+}
@@ -0,0 +1,170 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"testing"
+)
+
+// aeadPair 返回以同一密钥与 IV 创建的发送方与接收方状态。
+func aeadPair(t testing.TB) (tx, rx *FrameAEAD) {
+	t.Helper()
+	key := bytes.Repeat([]byte{0x42}, 32)
+	iv := bytes.Repeat([]byte{0x24}, aeadNonceSize)
+	mk := func() *FrameAEAD {
+		blk, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gcm, err := cipher.NewGCM(blk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := NewFrameAEAD(gcm, iv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	return mk(), mk()
+}
+
+// sealFrames 将 msgs 逐条编码为单帧并密封，返回各认证帧。
+func sealFrames(t testing.TB, tx *FrameAEAD, msgs ...string) [][]byte {
+	t.Helper()
+	enc, _ := NewEncoder()
+	var out [][]byte
+	for i, m := range msgs {
+		fr, err := enc.AppendSingle(nil, uint16(i+1), []byte(m), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed, err := tx.Seal(nil, fr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, sealed)
+	}
+	return out
+}
+
+func aeadParser(rx *FrameAEAD) *Parser {
+	p, _ := NewParser()
+	p.SetAEAD(rx)
+	return p
+}
+
+type rxMsg struct {
+	api uint16
+	msg string
+}
+
+func collect(p *Parser, buf []byte) ([]rxMsg, int, error) {
+	var got []rxMsg
+	n, err := p.Parse(buf, func(api uint16, b []byte) error {
+		got = append(got, rxMsg{api, string(b)})
+		return nil
+	})
+	return got, n, err
+}
+
+func TestAEADRoundTrip(t *testing.T) {
+	tx, rx := aeadPair(t)
+	enc, _ := NewEncoder()
+	var stream []byte
+	for _, f := range sealFrames(t, tx, "hello", "", "world") {
+		stream = append(stream, f...)
+	}
+	batch, err := enc.AppendBatch(nil, []BatchItem{{Api: 7, Payload: []byte("a")}, {Api: 8, Payload: []byte("bc")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stream, err = tx.Seal(stream, batch); err != nil {
+		t.Fatal(err)
+	}
+	got, n, err := collect(aeadParser(rx), stream)
+	if err != nil || n != len(stream) {
+		t.Fatalf("parse n=%d/%d err=%v", n, len(stream), err)
+	}
+	want := []rxMsg{{1, "hello"}, {2, ""}, {3, "world"}, {7, "a"}, {8, "bc"}}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("msg %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestAEADTampered(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		pos  func(f []byte) int
+	}{
+		{"header", func(f []byte) int { return 0 }},
+		{"api", func(f []byte) int { return 2 }},
+		{"payload", func(f []byte) int { return 5 }},
+		{"tag", func(f []byte) int { return len(f) - 1 }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tx, rx := aeadPair(t)
+			f := sealFrames(t, tx, "tamper me")[0]
+			// 头部只改压缩位，长度不变，帧仍完整
+			bit := byte(0x01)
+			if tc.name == "header" {
+				bit = 0x80
+			}
+			f[tc.pos(f)] ^= bit
+			got, _, err := collect(aeadParser(rx), f)
+			if !errors.Is(err, ErrAuthFailed) || len(got) != 0 {
+				t.Fatalf("got %v, err %v, want ErrAuthFailed", got, err)
+			}
+		})
+	}
+}
+
+func TestAEADReplay(t *testing.T) {
+	tx, rx := aeadPair(t)
+	f := sealFrames(t, tx, "once")[0]
+	p := aeadParser(rx)
+	if _, _, err := collect(p, f); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, err := collect(p, f); !errors.Is(err, ErrAuthFailed) || len(got) != 0 {
+		t.Fatalf("replay: got %v, err %v, want ErrAuthFailed", got, err)
+	}
+}
+
+func TestAEADReordered(t *testing.T) {
+	tx, rx := aeadPair(t)
+	fs := sealFrames(t, tx, "first", "second")
+	p := aeadParser(rx)
+	if got, _, err := collect(p, fs[1]); !errors.Is(err, ErrAuthFailed) || len(got) != 0 {
+		t.Fatalf("reordered: got %v, err %v, want ErrAuthFailed", got, err)
+	}
+	// 丢帧同样失步
+	tx, rx = aeadPair(t)
+	fs = sealFrames(t, tx, "first", "second")
+	if got, _, err := collect(aeadParser(rx), fs[1]); !errors.Is(err, ErrAuthFailed) || len(got) != 0 {
+		t.Fatalf("dropped: got %v, err %v, want ErrAuthFailed", got, err)
+	}
+}
+
+// TestAEADShortFrame 校验明文不足以容纳 api 的合法密封帧被拒绝而非越界。
+func TestAEADShortFrame(t *testing.T) {
+	for _, pt := range [][]byte{nil, {0x01}} {
+		tx, rx := aeadPair(t)
+		hdr, err := AppendLenFlags(nil, len(pt)+tx.Overhead()-2, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := tx.aead.Seal(hdr, tx.nextNonce(), pt, hdr)
+		got, n, err := collect(aeadParser(rx), f)
+		if !errors.Is(err, ErrMalformedFrame) || n != len(f) || len(got) != 0 {
+			t.Fatalf("plaintext %d bytes: got %v, n=%d, err %v, want ErrMalformedFrame", len(pt), got, n, err)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package protocol
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/legamerdc/gio/internal/bufpool"
+)
+
+// 解压结果写入池化缓冲：批内消息为其子切片，不逐条分配，回调返回后缓冲即归还池。
+// 回调中需要保留负载时以 Parser.Retain 取得引用（Ref），Release 后归还。
+
+// BufferPool 为解析器提供解压缓冲，Get 返回长度为 n 的切片。
+// Ref.Release 可能在其他 goroutine 中调用 Put，实现须并发安全。
+type BufferPool interface {
+	Get(n int) []byte
+	Put(b []byte)
+}
+
+// defaultPool 为未经 SetBufferPool 指定时所用的池，进程内共享。
+var defaultPool BufferPool = bufpool.New()
+
+// maxHint 为按声明长度预取缓冲的上限；声明的长度不可信，超出部分随实际解出的字节增长。
+const maxHint = 1 << 20
+
+// buffer 为引用计数的池化缓冲，最后一个引用释放后归还 pool。
+// gen 在每次归还时递增，Ref 据此识别缓冲已被回收复用。
+type buffer struct {
+	b    []byte
+	refs atomic.Int32
+	gen  atomic.Uint32
+	pool BufferPool
+}
+
+var buffers = sync.Pool{New: func() any { return new(buffer) }}
+
+// newBuffer 返回长度为 0、容量不小于 n 的缓冲，持有一个引用。
+func newBuffer(pool BufferPool, n int) *buffer {
+	b := buffers.Get().(*buffer)
+	b.b = pool.Get(n)[:0]
+	b.pool = pool
+	b.refs.Store(1)
+	return b
+}
+
+// set 记录追加写入后的结果；追加时发生了扩容则先归还原缓冲。
+func (b *buffer) set(out []byte) {
+	if cap(out) != cap(b.b) {
+		b.pool.Put(b.b)
+	}
+	b.b = out
+}
+
+func (b *buffer) release() {
+	if b == nil {
+		return
+	}
+	switch n := b.refs.Add(-1); {
+	case n == 0:
+		b.gen.Add(1)
+		b.pool.Put(b.b)
+		b.b, b.pool = nil, nil
+		buffers.Put(b)
+	case n < 0:
+		panic(errRefReleased)
+	}
+}
+
+// errRefReleased 为重复 Release 或对已释放的 Ref 调用 Retain 时的 panic 值。
+var errRefReleased = errors.New("protocol: Ref used after its last Release")
+
+// Ref 是对一条消息负载的引用（见 Parser.Retain），Release 之前 Bytes 一直有效。
+// 每个 Ref（含 Retain 返回的副本）只能 Release 一次；零值 Ref 的 Release 为空操作。
+// 缓冲的最后一个引用释放后，再对其任一 Ref 调用 Release 或 Retain 会 panic；
+// 其他引用尚在时的重复 Release 使计数提前归零，随后其余引用的 Release 同样 panic。
+type Ref struct {
+	buf  *buffer
+	data []byte
+	gen  uint32
+}
+
+func newRef(b *buffer, data []byte) Ref { return Ref{buf: b, data: data, gen: b.gen.Load()} }
+
+// Bytes 返回被引用的负载。
+func (r Ref) Bytes() []byte { return r.data }
+
+// Retain 增加一个引用并返回之，两者须各自 Release。
+func (r Ref) Retain() Ref {
+	if r.buf != nil {
+		if r.buf.gen.Load() != r.gen || r.buf.refs.Add(1) <= 1 {
+			panic(errRefReleased)
+		}
+	}
+	return r
+}
+
+// Release 释放引用；之后不得再使用 Bytes 返回的切片。
+func (r Ref) Release() {
+	if r.buf != nil && r.buf.gen.Load() != r.gen {
+		panic(errRefReleased)
+	}
+	r.buf.release()
+}
+
+// SetBufferPool 设置解压缓冲与 Retain 拷贝所用的池，nil 表示进程内共享的默认池。
+func (p *Parser) SetBufferPool(pool BufferPool) { p.pool = pool }
+
+func (p *Parser) bufferPool() BufferPool {
+	if p.pool == nil {
+		return defaultPool
+	}
+	return p.pool
+}
+
+// Retain 只能在 Parse/ParseFrame 的回调中调用，使当前消息负载在回调返回后继续有效，
+// 直到返回的 Ref 被 Release。负载位于池化解压缓冲（批量帧、压缩帧）时只增加引用计数，
+// 否则（负载指向输入）拷贝到池化缓冲。空负载或在回调之外调用时返回零值 Ref。
+func (p *Parser) Retain() Ref {
+	if !p.inCb || len(p.msg) == 0 {
+		return Ref{}
+	}
+	if p.cur != nil {
+		p.cur.refs.Add(1)
+		return newRef(p.cur, p.msg)
+	}
+	b := newBuffer(p.bufferPool(), len(p.msg))
+	b.b = append(b.b, p.msg...)
+	return newRef(b, b.b)
+}
+
+// deliver 回调一条消息，buf 为其所在的池化缓冲（可为 nil），供回调期间的 Retain 使用。
+func (p *Parser) deliver(buf *buffer, api uint16, msg []byte, onMessage func(api uint16, payload []byte) error) error {
+	p.cur, p.msg, p.inCb = buf, msg, true
+	err := onMessage(api, msg)
+	p.cur, p.msg, p.inCb = nil, nil, false
+	return err
+}
+
+// sizeHinter 可由内置算法实现：由压缩体的头部读出解压后的长度，未知时返回 0。
+type sizeHinter interface {
+	decodedSize(src []byte) int
+}
+
+// decodedSize 返回 src 解压后的长度，算法未声明时按压缩体长度估计。
+func (p *Parser) decodedSize(src []byte) int {
+	if h, ok := p.comp.(sizeHinter); ok {
+		if n := h.decodedSize(src); n > 0 {
+			return n
+		}
+	}
+	return 4 * len(src)
+}
+
+// hint 将声明的解压长度限制在上限内，作为预取缓冲的长度。
+func (p *Parser) hint(n int) int {
+	if max := p.lim.MaxDecompressed; max > 0 {
+		n = min(n, max)
+	}
+	return max(min(n, maxHint), 0)
+}
@@ -0,0 +1,106 @@
+package protocol
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countPool 统计 Get 与 Put 的次数。
+type countPool struct{ gets, puts atomic.Int64 }
+
+func (p *countPool) Get(n int) []byte { p.gets.Add(1); return make([]byte, n) }
+func (p *countPool) Put(b []byte)     { p.puts.Add(1) }
+
+// retainAll 解析 fr 并保留每条消息，返回引用。
+func retainAll(t *testing.T, p *Parser, fr []byte) []Ref {
+	t.Helper()
+	var refs []Ref
+	if _, err := p.Parse(fr, func(api uint16, b []byte) error {
+		refs = append(refs, p.Retain())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return refs
+}
+
+func mustPanic(t *testing.T, what string, fn func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s did not panic", what)
+		}
+	}()
+	fn()
+}
+
+// TestRefMisuse 校验重复 Release 与最后一次 Release 之后的 Retain 被检出，
+// 包括缓冲已归还池之后经其他副本的重复释放。
+func TestRefMisuse(t *testing.T) {
+	enc, _ := NewEncoder()
+	msg := benchPayload(1000)
+	compressed, _ := enc.AppendSingle(nil, 1, msg, FlagCompress)
+	plain, _ := enc.AppendSingle(nil, 1, msg, 0)
+	for _, tc := range []struct {
+		name string
+		fr   []byte
+	}{{"pooled", compressed}, {"copied", plain}} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, _ := NewParser()
+			r := retainAll(t, p, tc.fr)[0]
+			if !bytes.Equal(r.Bytes(), msg) {
+				t.Fatal("retained payload mismatch")
+			}
+			r.Release()
+			mustPanic(t, "second Release", r.Release)
+			mustPanic(t, "Retain after the last Release", func() { r.Retain() })
+
+			r = retainAll(t, p, tc.fr)[0]
+			r2 := r.Retain()
+			r.Release()
+			r.Release() // 计数提前归零，缓冲已归还
+			mustPanic(t, "Release of the remaining copy", r2.Release)
+		})
+	}
+	var zero Ref
+	zero.Release()
+	zero.Retain().Release()
+}
+
+// TestRefConcurrent 校验同一缓冲上的引用在多个 goroutine 中并发 Retain/Release 后缓冲恰好归还一次。
+func TestRefConcurrent(t *testing.T) {
+	enc, _ := NewEncoder()
+	items := make([]BatchItem, 64)
+	for i := range items {
+		items[i] = BatchItem{Api: uint16(i), Payload: benchPayload(100 + i)}
+	}
+	fr, _ := enc.AppendBatch(nil, items)
+	pool := &countPool{}
+	p, _ := NewParser()
+	p.SetBufferPool(pool)
+	refs := retainAll(t, p, fr)
+	if len(refs) != len(items) {
+		t.Fatalf("retained %d refs, want %d", len(refs), len(items))
+	}
+	var wg sync.WaitGroup
+	for i, r := range refs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				c := r.Retain()
+				if !bytes.Equal(c.Bytes(), items[i].Payload) {
+					t.Errorf("ref %d: payload changed", i)
+				}
+				c.Release()
+			}
+			r.Release()
+		}()
+	}
+	wg.Wait()
+	if g, p := pool.gets.Load(), pool.puts.Load(); g == 0 || g != p {
+		t.Fatalf("pool gets %d, puts %d", g, p)
+	}
+}
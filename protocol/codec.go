@@ -1,10 +1,8 @@
 package protocol
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
-	"io"
 )
 
 // BatchItem 用于批前镜像编码。
@@ -13,154 +11,371 @@ type BatchItem struct {
 	Payload []byte
 }
 
+// Flags 为 AppendSingle 的编码选项。
+type Flags uint8
+
+const (
+	// FlagCompress 以编码器的压缩算法压缩负载。
+	FlagCompress Flags = 1 << iota
+	// FlagCompressed 表示负载已以对端协商的算法压缩，按原样封帧并置 Compressed 位。
+	FlagCompressed
+)
+
+// maxScratch 为编码器跨调用保留的批前镜像暂存上限，超出的大批次用后即弃。
+const maxScratch = 1 << 20
+
 // Encoder 提供单帧/批量帧编码。
 // 注：批量帧总是压缩（Batched => Compressed）。
+// Append* 将帧追加到调用方的缓冲，容量足够时不分配内存；编码器复用内部暂存，非并发安全。
+
+type Encoder struct {
+	comp Compressor
+	// 非 nil 时批量帧经流式上下文压缩（上下文接管）
+	ctx *streamEncoder
+	// 批前镜像暂存
+	pre []byte
+}
+
+// NewEncoder 返回使用默认压缩算法的编码器，可经 SetCompressor 更换。
+func NewEncoder() (*Encoder, error) { return &Encoder{comp: defaultCompressor()}, nil }
+
+// SetCompressor 设置其后压缩所用的算法，须与对端解析器一致。
+func (e *Encoder) SetCompressor(c Compressor) { e.comp = c }
+
+// Compressor 返回当前压缩算法。
+func (e *Encoder) Compressor() Compressor { return e.comp }
+
+// compress 将 api 的负载压缩后追加到 dst，算法实现 APICompressor 时按 api 选择参数（字典）。
+func (e *Encoder) compress(dst, src []byte, api uint16) ([]byte, error) {
+	if ac, ok := e.comp.(APICompressor); ok {
+		return ac.CompressAPI(dst, src, api)
+	}
+	return e.comp.Compress(dst, src)
+}
 
-type Encoder struct{}
+func (e *Encoder) Close() error {
+	if e.ctx != nil {
+		e.ctx.close()
+	}
+	return nil
+}
+
+// SetContext 启用上下文接管：其后不超过 window 的批量帧经本编码器独有的流式 zstd 压缩，
+// 引用此前的批量流量；对端解析器须以相同 window 调用 SetContext。只能调用一次。
+func (e *Encoder) SetContext(window int) error {
+	if !ValidContextWindow(window) {
+		return ErrContextWindow
+	}
+	e.ctx = &streamEncoder{window: window}
+	return nil
+}
 
-func NewEncoder() (*Encoder, error) { return &Encoder{}, nil }
+// ContextMemory 返回发送方向上下文状态当前占用的字节数（见 Parser.ContextMemory），
+// 未启用、尚未发送上下文帧或已重置时为 0。
+func (e *Encoder) ContextMemory() int {
+	if e.ctx == nil {
+		return 0
+	}
+	return e.ctx.memory()
+}
 
-func (e *Encoder) Close() error { return nil }
+// ResetContext 停止上下文接管并释放流式状态，其后的批量帧均为无状态压缩；
+// 调用方须在此前的上下文帧之后发出 ApiContextReset，对端据此释放解码状态。
+func (e *Encoder) ResetContext() {
+	if e.ctx != nil {
+		e.ctx.close()
+		e.ctx = nil
+	}
+}
 
 // EncodeSingle 返回：头部+可选 api + payload（压缩可选）。
 func (e *Encoder) EncodeSingle(api uint16, payload []byte, compressed bool) (frame []byte, _ error) {
-	var body []byte
+	var f Flags
 	if compressed {
-		zw := getEncoder()
-		body = zw.EncodeAll(payload, nil)
-		putEncoder(zw)
-	} else {
-		body = payload
+		f = FlagCompress
 	}
-	hdr, _, err := EncodeLenFlags(len(body), compressed, false)
+	return e.AppendSingle(nil, api, payload, f)
+}
+
+// AppendSingle 将单条消息编码为一帧追加到 dst；出错时返回原 dst。
+func (e *Encoder) AppendSingle(dst []byte, api uint16, payload []byte, flags Flags) ([]byte, error) {
+	if flags&FlagCompress == 0 {
+		return e.AppendFrame(dst, api, payload, flags&FlagCompressed != 0, false)
+	}
+	// 压缩后长度未知：预留长头，压缩直接写入 dst，再补写头部
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0)
+	dst = AppendApi(dst, api)
+	out, err := e.compress(dst, payload, api)
+	if err != nil {
+		return dst[:start], err
+	}
+	return finishFrame(out, start, true, false)
+}
+
+// EncodeFrame 按原样封帧 body（不做压缩），用于业务侧已压缩（compressed）
+// 或已合并压缩（batched，忽略 api）的负载；返回的帧不引用 body。
+func (e *Encoder) EncodeFrame(api uint16, body []byte, compressed, batched bool) ([]byte, error) {
+	return e.AppendFrame(nil, api, body, compressed, batched)
+}
+
+// AppendFrame 同 EncodeFrame，帧追加到 dst；出错时返回原 dst。
+func (e *Encoder) AppendFrame(dst []byte, api uint16, body []byte, compressed, batched bool) ([]byte, error) {
+	dst, err := AppendLenFlags(dst, len(body), compressed, batched)
 	if err != nil {
-		return nil, err
+		return dst, err
+	}
+	if !batched {
+		dst = AppendApi(dst, api)
 	}
-	out := make([]byte, 0, len(hdr)+2+len(body))
-	out = append(out, hdr...)
-	out = AppendApi(out, api)
-	out = append(out, body...)
-	return out, nil
+	return append(dst, body...), nil
 }
 
 // EncodeBatch 将一批消息编码为批前镜像并压缩，返回单帧（Batched=1，隐含 Compressed=1，无 Api 字段）。
 func (e *Encoder) EncodeBatch(items []BatchItem) ([]byte, error) {
-	var pre bytes.Buffer
-	// numMessages
-	var uvBuf [binary.MaxVarintLen64]byte
-	n := binary.PutUvarint(uvBuf[:], uint64(len(items)))
-	pre.Write(uvBuf[:n])
+	return e.AppendBatch(nil, items)
+}
+
+// AppendBatch 同 EncodeBatch，帧追加到 dst；出错时返回原 dst。
+func (e *Encoder) AppendBatch(dst []byte, items []BatchItem) ([]byte, error) {
+	// numMessages | (api | len | payload)*
+	pre := binary.AppendUvarint(e.pre[:0], uint64(len(items)))
 	for _, it := range items {
-		// api
-		var a [2]byte
-		binary.BigEndian.PutUint16(a[:], it.Api)
-		pre.Write(a[:])
-		// len
-		n = binary.PutUvarint(uvBuf[:], uint64(len(it.Payload)))
-		pre.Write(uvBuf[:n])
-		// payload
-		pre.Write(it.Payload)
-	}
-	// 压缩 pre-image
-	zw := getEncoder()
-	body := zw.EncodeAll(pre.Bytes(), nil)
-	putEncoder(zw)
-	hdr, _, err := EncodeLenFlags(len(body), true, true)
+		pre = AppendApi(pre, it.Api)
+		pre = binary.AppendUvarint(pre, uint64(len(it.Payload)))
+		pre = append(pre, it.Payload...)
+	}
+	if cap(pre) <= maxScratch {
+		e.pre = pre
+	} else {
+		e.pre = nil
+	}
+	// 压缩 pre-image，直接写入预留长头之后
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0)
+	var out []byte
+	var err error
+	stream := e.ctx != nil && len(pre) <= e.ctx.window
+	if stream {
+		out, err = e.ctx.encode(dst, pre)
+	} else {
+		var api uint16
+		if len(items) > 0 {
+			api = items[0].Api
+		}
+		out, err = e.compress(dst, pre, api)
+	}
 	if err != nil {
-		return nil, err
+		return dst[:start], err
 	}
-	out := make([]byte, 0, len(hdr)+len(body))
-	out = append(out, hdr...)
-	out = append(out, body...)
-	return out, nil
+	return finishFrame(out, start, !stream, true)
+}
+
+// finishFrame 补写 dst[start:] 处的帧头：调用方已在 start 处预留 MaxHeaderLen 字节，
+// 其后为 api（非批量）与帧体；短头时将其后内容前移 2 字节。
+func finishFrame(dst []byte, start int, compressed, batched bool) ([]byte, error) {
+	length := len(dst) - start - MaxHeaderLen
+	if !batched {
+		length -= 2
+	}
+	var h [MaxHeaderLen]byte
+	n, err := putHeader(&h, length, compressed, batched)
+	if err != nil {
+		return dst[:start], err
+	}
+	if n < MaxHeaderLen {
+		dst = append(dst[:start+n], dst[start+MaxHeaderLen:]...)
+	}
+	copy(dst[start:], h[:n])
+	return dst, nil
 }
 
 // Parser 按帧解析；对批量帧进行解压并回调每条消息。
-// 回调可选择消费错误终止解析。
+// 回调可选择消费错误终止解析。回调收到的负载仅在回调期间有效，需保留时调用 Retain。
 
-type Parser struct{}
+type Parser struct {
+	// 非 nil 时每帧先校验并解密（AEAD 模式）
+	aead *FrameAEAD
+	comp Compressor
+	// 非 nil 时可解码上下文帧
+	ctx *streamDecoder
+	lim Limits
+	// 解压缓冲池；回调期间的当前消息及其所在的池化缓冲（负载指向输入时为 nil），供 Retain 使用
+	pool BufferPool
+	cur  *buffer
+	msg  []byte
+	inCb bool
+}
 
-func NewParser() (*Parser, error) { return &Parser{}, nil }
+// NewParser 返回使用默认压缩算法、以 DefaultLimits 为上限的解析器；
+// 解析不可信输入时不应以 SetLimits(Limits{}) 取消上限（块压缩按帧声明的解压长度一次分配）。
+func NewParser() (*Parser, error) {
+	return &Parser{comp: defaultCompressor(), lim: DefaultLimits()}, nil
+}
+
+// SetCompressor 设置解压所用的算法；可在回调中调用，从下一帧起生效。
+func (p *Parser) SetCompressor(c Compressor) { p.comp = c }
+
+func (p *Parser) Close() error {
+	if p.ctx != nil {
+		p.ctx.close()
+	}
+	return nil
+}
+
+// SetContext 使解析器接受窗口不超过 window 的上下文帧（见 Encoder.SetContext）；
+// 解码状态在收到第一个上下文帧时才创建。上下文帧解码失败后连接须关闭（ErrContextBroken）。
+func (p *Parser) SetContext(window int) error {
+	if !ValidContextWindow(window) {
+		return ErrContextWindow
+	}
+	p.ctx = &streamDecoder{window: window}
+	return nil
+}
 
-func (p *Parser) Close() error { return nil }
+// ContextMemory 返回接收方向上下文状态当前占用的字节数：解码器的固定开销与已保留的历史（不超过窗口），
+// 未启用、尚未收到上下文帧或已重置时为 0。
+func (p *Parser) ContextMemory() int {
+	if p.ctx == nil {
+		return 0
+	}
+	return p.ctx.memory()
+}
+
+// ResetContext 释放上下文解码状态（对端已发出 ApiContextReset），其后收到的上下文帧返回 ErrContextBroken；
+// 可在回调中调用。
+func (p *Parser) ResetContext() {
+	if p.ctx != nil {
+		p.ctx.close()
+		p.ctx = nil
+	}
+}
+
+// SetAEAD 使其后解析的每一帧都须通过 a 的校验，失败时返回 ErrAuthFailed；
+// 可在回调中调用，从下一帧起生效。
+func (p *Parser) SetAEAD(a *FrameAEAD) { p.aead = a }
 
 var ErrIncomplete = errors.New("protocol: incomplete frame")
 
 // Parse 尝试从 buf 解析尽可能多的帧；返回已消费字节数。
 // onMessage(api, payload) 在非批量时直接回调；在批量时对每条批内消息回调。
+// 回调返回错误时，所在帧视为已消费，解析随即终止。
 func (p *Parser) Parse(buf []byte, onMessage func(api uint16, payload []byte) error) (consumed int, _ error) {
 	i := 0
 	for {
-		if len(buf[i:]) < 2 {
-			return i, nil // 不足以判断头
-		}
-		c, length, compressed, batched, err := DecodeLenFlags(buf[i:])
-		if err != nil {
+		n, err := p.ParseFrame(buf[i:], onMessage)
+		i += n
+		if err != nil || n == 0 {
 			return i, err
 		}
-		if !batched {
-			// 非批量：长度不包含 Api，需要额外读取 2 字节的 Api
-			if len(buf[i+c:]) < 2+length {
-				return i, nil // 不完整帧
-			}
-			api := binary.BigEndian.Uint16(buf[i+c : i+c+2])
-			msg := buf[i+c+2 : i+c+2+length]
-			if compressed {
-				dz := getDecoder()
-				out, derr := dz.DecodeAll(msg, nil)
-				putDecoder(dz)
-				if derr != nil {
-					return i, derr
-				}
-				msg = out
-			}
-			if err := onMessage(api, msg); err != nil {
-				return i, err
+	}
+}
+
+// ParseFrame 最多解析一帧；帧不完整时返回 0, nil。
+// 调用方可借此在帧边界上暂停解析（例如关闭读事件期间）。
+func (p *Parser) ParseFrame(buf []byte, onMessage func(api uint16, payload []byte) error) (consumed int, _ error) {
+	if len(buf) < 2 {
+		return 0, nil // 不足以判断头
+	}
+	c, length, compressed, batched, err := DecodeLenFlags(buf)
+	if err != nil {
+		if err == errHeaderTooShort {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if p.lim.MaxFrame > 0 && length > p.lim.MaxFrame {
+		return 0, ErrFrameTooLarge
+	}
+	// 非批量：长度不包含 Api，需要额外读取 2 字节的 Api
+	n := c + length
+	if !batched {
+		n += 2
+	}
+	if len(buf) < n {
+		return 0, nil // 不完整帧
+	}
+	body := buf[c:n]
+	if p.aead != nil {
+		if body, err = p.aead.open(buf[:c], body); err != nil {
+			return n, err
+		}
+	}
+	if !batched {
+		// 认证帧的明文长度由对端密封时决定，须容纳 api
+		if len(body) < 2 {
+			return n, ErrMalformedFrame
+		}
+		api := binary.BigEndian.Uint16(body[:2])
+		msg := body[2:]
+		var pb *buffer
+		if compressed {
+			if pb, err = p.decompress(msg); err != nil {
+				return n, err
 			}
-			i += c + 2 + length
-			continue
+			msg = pb.b
 		}
-		// 批量：payload 为压缩后的 pre-image，长度即为压缩体长度
-		if len(buf[i+c:]) < length {
-			return i, nil // 不完整帧
+		if p.lim.MaxMessage > 0 && len(msg) > p.lim.MaxMessage {
+			pb.release()
+			return n, ErrMessageTooLarge
 		}
-		payload := buf[i+c : i+c+length]
-		i += c + length
-		dz := getDecoder()
-		out, derr := dz.DecodeAll(payload, nil)
-		putDecoder(dz)
-		if derr != nil {
-			return i, derr
+		err = p.deliver(pb, api, msg, onMessage)
+		pb.release()
+		return n, err
+	}
+	// 批量：payload 为压缩后的 pre-image（Compressed=0 时为上下文帧），解压到池化缓冲
+	var pb *buffer
+	switch {
+	case compressed:
+		pb, err = p.decompress(body)
+	case p.ctx != nil:
+		pb, err = p.decodeContext(body)
+	default:
+		err = ErrContextBroken
+	}
+	if err != nil {
+		return n, err
+	}
+	defer pb.release()
+	// 解析 pre-image，批内消息为缓冲的子切片
+	out := pb.b
+	num, k := binary.Uvarint(out)
+	if k <= 0 {
+		return n, ErrMalformedBatch
+	}
+	out = out[k:]
+	if p.lim.MaxBatchMsgs > 0 && num > uint64(p.lim.MaxBatchMsgs) {
+		return n, ErrBatchTooLarge
+	}
+	// 每条消息至少占 3 字节（api + 长度），声明的条数不可能超过剩余字节
+	if num > uint64(len(out))/3 {
+		return n, ErrMalformedBatch
+	}
+	for j := uint64(0); j < num; j++ {
+		if len(out) < 2 {
+			return n, ErrMalformedBatch
 		}
-		// 解析 pre-image
-		r := bytes.NewReader(out)
-		num, err := binary.ReadUvarint(r)
-		if err != nil {
-			return i, err
+		api := binary.BigEndian.Uint16(out)
+		ln, k := binary.Uvarint(out[2:])
+		if k <= 0 {
+			return n, ErrMalformedBatch
 		}
-		for j := uint64(0); j < num; j++ {
-			var ab [2]byte
-			if _, err := io.ReadFull(r, ab[:]); err != nil {
-				return i, err
-			}
-			api := binary.BigEndian.Uint16(ab[:])
-			ln, err := binary.ReadUvarint(r)
-			if err != nil {
-				return i, err
-			}
-			if ln == 0 {
-				if err := onMessage(api, nil); err != nil {
-					return i, err
-				}
-				continue
-			}
-			msg := make([]byte, ln)
-			if _, err := io.ReadFull(r, msg); err != nil {
-				return i, err
-			}
-			if err := onMessage(api, msg); err != nil {
-				return i, err
-			}
+		out = out[2+k:]
+		if p.lim.MaxMessage > 0 && ln > uint64(p.lim.MaxMessage) {
+			return n, ErrMessageTooLarge
+		}
+		if ln > uint64(len(out)) {
+			return n, ErrMalformedBatch
+		}
+		// 限定容量，回调追加写入不会覆盖后续消息
+		var msg []byte
+		if ln > 0 {
+			msg = out[:ln:ln]
+		}
+		out = out[ln:]
+		if err := p.deliver(pb, api, msg, onMessage); err != nil {
+			return n, err
 		}
 	}
+	return n, nil
 }
@@ -0,0 +1,124 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func benchPayload(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i * 7 % 251)
+	}
+	return b
+}
+
+func BenchmarkAppendSingle(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		flags Flags
+	}{{"plain", 0}, {"compress", FlagCompress}} {
+		b.Run(bc.name, func(b *testing.B) {
+			enc, err := NewEncoder()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer enc.Close()
+			msg := benchPayload(300)
+			dst := make([]byte, 0, 64<<10)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(msg)))
+			b.ResetTimer()
+			for range b.N {
+				if dst, err = enc.AppendSingle(dst[:0], 1, msg, bc.flags); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAppendBatch(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		window int
+	}{{"stateless", 0}, {"context", 64 << 10}} {
+		b.Run(bc.name, func(b *testing.B) {
+			enc, err := NewEncoder()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer enc.Close()
+			if bc.window > 0 {
+				if err := enc.SetContext(bc.window); err != nil {
+					b.Fatal(err)
+				}
+			}
+			msg := benchPayload(300)
+			items := make([]BatchItem, 16)
+			for i := range items {
+				items[i] = BatchItem{Api: uint16(i), Payload: msg}
+			}
+			dst := make([]byte, 0, 64<<10)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(items) * len(msg)))
+			b.ResetTimer()
+			for range b.N {
+				if dst, err = enc.AppendBatch(dst[:0], items); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestAppendZeroAlloc 校验稳态下 Append 编码不分配内存（dst 容量足够时）。
+func TestAppendZeroAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops items under the race detector")
+	}
+	enc, err := NewEncoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	msg := benchPayload(300)
+	items := []BatchItem{{Api: 1, Payload: msg}, {Api: 2, Payload: msg}}
+	dst := make([]byte, 0, 64<<10)
+	for _, tc := range []struct {
+		name string
+		fn   func()
+	}{
+		{"single", func() { dst, _ = enc.AppendSingle(dst[:0], 1, msg, 0) }},
+		{"single/compress", func() { dst, _ = enc.AppendSingle(dst[:0], 1, msg, FlagCompress) }},
+		{"batch", func() { dst, _ = enc.AppendBatch(dst[:0], items) }},
+	} {
+		if a := testing.AllocsPerRun(200, tc.fn); a != 0 {
+			t.Errorf("%s: %.2f allocs/op, want 0", tc.name, a)
+		}
+	}
+}
+
+// TestAppendRoundTrip 校验 Append 追加到已有前缀后的帧可被解析。
+func TestAppendRoundTrip(t *testing.T) {
+	enc, _ := NewEncoder()
+	p, _ := NewParser()
+	big := benchPayload(9000)
+	for _, flags := range []Flags{0, FlagCompress} {
+		for _, m := range [][]byte{nil, benchPayload(300), big} {
+			fr, err := enc.AppendSingle([]byte("prefix"), 3, m, flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := p.Parse(fr[6:], func(api uint16, b []byte) error {
+				if api != 3 || !bytes.Equal(b, m) {
+					t.Errorf("flags=%d len=%d: got api %d len %d", flags, len(m), api, len(b))
+				}
+				return nil
+			})
+			if err != nil || n != len(fr)-6 {
+				t.Fatalf("flags=%d len=%d: parse n=%d err=%v", flags, len(m), n, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressor 为帧负载的压缩算法。头部的 Compressed 位表示“以本连接协商的算法压缩”，
+// 两端须使用同名算法（server.Config.CompressionAlgo / client.Config.CompressionAlgo，或握手协商）。
+// 实现须可并发使用。
+type Compressor interface {
+	// Name 为注册名，握手中以此协商。
+	Name() string
+	// Compress 将 src 压缩后追加到 dst。
+	Compress(dst, src []byte) ([]byte, error)
+	// Decompress 将 src 解压后追加到 dst。
+	Decompress(dst, src []byte) ([]byte, error)
+}
+
+// LimitedDecompressor 可由 Compressor 额外实现：解压结果将超过 max 字节时返回
+// ErrDecompressedTooLarge，且不必先完整解出（max<=0 表示不限）。内置算法均实现此接口；
+// 未实现时 Parser 在解压后再检查长度。
+type LimitedDecompressor interface {
+	DecompressLimit(dst, src []byte, max int) ([]byte, error)
+}
+
+// DefaultCompression 为未指定算法时使用的压缩算法名（zstd SpeedFastest）。
+const DefaultCompression = "zstd"
+
+var ErrUnknownCompressor = errors.New("protocol: unknown compressor")
+
+var (
+	compMu      sync.RWMutex
+	compressors = map[string]Compressor{}
+)
+
+// RegisterCompressor 以 c.Name() 注册压缩算法，同名覆盖；通常在 init 中调用。
+func RegisterCompressor(c Compressor) {
+	compMu.Lock()
+	compressors[c.Name()] = c
+	compMu.Unlock()
+}
+
+// LookupCompressor 按名查找压缩算法，name 为空时返回默认算法。
+func LookupCompressor(name string) (Compressor, error) {
+	if name == "" {
+		name = DefaultCompression
+	}
+	compMu.RLock()
+	c, ok := compressors[name]
+	compMu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownCompressor
+	}
+	return c, nil
+}
+
+// Compressors 返回已注册的算法名（有序）。
+func Compressors() []string {
+	compMu.RLock()
+	names := make([]string, 0, len(compressors))
+	for n := range compressors {
+		names = append(names, n)
+	}
+	compMu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// 内置算法：
+//
+//	zstd / zstd-fastest, zstd-default, zstd-better, zstd-best
+//	s2, s2-better, s2-best
+//	snappy
+//	deflate, deflate-fast, deflate-best
+func init() {
+	RegisterCompressor(newZstd(DefaultCompression, zstd.SpeedFastest))
+	RegisterCompressor(newZstd("zstd-fastest", zstd.SpeedFastest))
+	RegisterCompressor(newZstd("zstd-default", zstd.SpeedDefault))
+	RegisterCompressor(newZstd("zstd-better", zstd.SpeedBetterCompression))
+	RegisterCompressor(newZstd("zstd-best", zstd.SpeedBestCompression))
+	RegisterCompressor(&blockCompressor{"s2", s2.Encode, s2.MaxEncodedLen, s2.DecodedLen, s2.Decode})
+	RegisterCompressor(&blockCompressor{"s2-better", s2.EncodeBetter, s2.MaxEncodedLen, s2.DecodedLen, s2.Decode})
+	RegisterCompressor(&blockCompressor{"s2-best", s2.EncodeBest, s2.MaxEncodedLen, s2.DecodedLen, s2.Decode})
+	RegisterCompressor(&blockCompressor{"snappy", snappy.Encode, snappy.MaxEncodedLen, snappy.DecodedLen, snappy.Decode})
+	RegisterCompressor(newDeflate("deflate", flate.DefaultCompression))
+	RegisterCompressor(newDeflate("deflate-fast", flate.BestSpeed))
+	RegisterCompressor(newDeflate("deflate-best", flate.BestCompression))
+}
+
+// zstdCompressor 按级别池化编码器，解码器跨级别共享。
+type zstdCompressor struct {
+	name string
+	pool sync.Pool
+}
+
+func newZstd(name string, level zstd.EncoderLevel) *zstdCompressor {
+	z := &zstdCompressor{name: name}
+	z.pool.New = func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+		return enc
+	}
+	return z
+}
+
+func (z *zstdCompressor) Name() string { return z.name }
+
+func (z *zstdCompressor) Compress(dst, src []byte) ([]byte, error) {
+	return encodeWith(&z.pool, dst, src), nil
+}
+
+func (z *zstdCompressor) decodedSize(src []byte) int { return zstdContentSize(src) }
+
+func (z *zstdCompressor) Decompress(dst, src []byte) ([]byte, error) {
+	return plainDecoders.decodeAll(dst, src, 0)
+}
+
+func (z *zstdCompressor) DecompressLimit(dst, src []byte, max int) ([]byte, error) {
+	return plainDecoders.decodeAll(dst, src, max)
+}
+
+// blockCompressor 适配 s2/snappy 的块格式函数。
+type blockCompressor struct {
+	name       string
+	encode     func(dst, src []byte) []byte
+	maxEncoded func(n int) int
+	decodedLen func(src []byte) (int, error)
+	decode     func(dst, src []byte) ([]byte, error)
+}
+
+func (b *blockCompressor) Name() string { return b.name }
+
+func (b *blockCompressor) Compress(dst, src []byte) ([]byte, error) {
+	n := b.maxEncoded(len(src))
+	if n < 0 {
+		return nil, errLengthOutOfRange
+	}
+	dst = grow(dst, n)
+	out := b.encode(dst[len(dst):len(dst)+n], src)
+	return dst[:len(dst)+len(out)], nil
+}
+
+func (b *blockCompressor) decodedSize(src []byte) int {
+	n, _ := b.decodedLen(src)
+	return n
+}
+
+func (b *blockCompressor) Decompress(dst, src []byte) ([]byte, error) {
+	return b.DecompressLimit(dst, src, 0)
+}
+
+// DecompressLimit 依据块头声明的解压长度在分配前检查上限；块格式只能一次解码到声明长度的缓冲，
+// max<=0 时按声明长度分配，仅适用于可信输入。
+func (b *blockCompressor) DecompressLimit(dst, src []byte, max int) ([]byte, error) {
+	n, err := b.decodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && n > max {
+		return nil, ErrDecompressedTooLarge
+	}
+	dst = grow(dst, n)
+	out, err := b.decode(dst[len(dst):len(dst)+n], src)
+	if err != nil {
+		return nil, err
+	}
+	return dst[:len(dst)+len(out)], nil
+}
+
+// grow 保证 dst 至少还有 n 字节可用容量。
+func grow(dst []byte, n int) []byte {
+	if cap(dst)-len(dst) >= n {
+		return dst
+	}
+	return append(dst, make([]byte, n)...)[:len(dst)]
+}
+
+// deflateCompressor 为原始 DEFLATE（RFC 1951），按级别池化写入器，读取器跨级别共享。
+type deflateCompressor struct {
+	name  string
+	wpool sync.Pool
+}
+
+var flateReaders sync.Pool
+
+func newDeflate(name string, level int) *deflateCompressor {
+	d := &deflateCompressor{name: name}
+	d.wpool.New = func() any {
+		w, _ := flate.NewWriter(nil, level)
+		return w
+	}
+	return d
+}
+
+func (d *deflateCompressor) Name() string { return d.name }
+
+func (d *deflateCompressor) Compress(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	w := d.wpool.Get().(*flate.Writer)
+	defer d.wpool.Put(w)
+	w.Reset(buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *deflateCompressor) Decompress(dst, src []byte) ([]byte, error) {
+	return d.DecompressLimit(dst, src, 0)
+}
+
+// DecompressLimit 最多读出 max+1 字节，超出即停止。
+func (d *deflateCompressor) DecompressLimit(dst, src []byte, max int) ([]byte, error) {
+	r, _ := flateReaders.Get().(io.ReadCloser)
+	if r == nil {
+		r = flate.NewReader(bytes.NewReader(src))
+	} else if err := r.(flate.Resetter).Reset(bytes.NewReader(src), nil); err != nil {
+		return nil, err
+	}
+	defer flateReaders.Put(r)
+	buf := bytes.NewBuffer(dst)
+	var in io.Reader = r
+	if max > 0 {
+		in = io.LimitReader(r, int64(max)+1)
+	}
+	n, err := buf.ReadFrom(in)
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && n > int64(max) {
+		return nil, ErrDecompressedTooLarge
+	}
+	return buf.Bytes(), nil
+}
+
+func defaultCompressor() Compressor {
+	c, _ := LookupCompressor(DefaultCompression)
+	return c
+}
@@ -0,0 +1,89 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// TestCompressorRoundTrip 校验每个已注册算法的直接压缩往返，以及经 Encoder/Parser 的单帧与批量帧往返。
+func TestCompressorRoundTrip(t *testing.T) {
+	payloads := [][]byte{nil, []byte("x"), benchPayload(300), benchPayload(200 << 10)}
+	for _, name := range Compressors() {
+		t.Run(name, func(t *testing.T) {
+			comp, err := LookupCompressor(name)
+			if err != nil || comp.Name() != name {
+				t.Fatalf("LookupCompressor(%q) = %v, %v", name, comp, err)
+			}
+			for _, m := range payloads {
+				z, err := comp.Compress([]byte("prefix"), m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				out, err := comp.Decompress([]byte("dst"), z[6:])
+				if err != nil || !bytes.Equal(out[3:], m) || string(out[:3]) != "dst" {
+					t.Fatalf("len %d: Decompress = %d bytes, %v", len(m), len(out)-3, err)
+				}
+				if ld, ok := comp.(LimitedDecompressor); ok && len(m) > 1 {
+					if _, err := ld.DecompressLimit(nil, z[6:], len(m)-1); !errors.Is(err, ErrDecompressedTooLarge) {
+						t.Fatalf("len %d: DecompressLimit below size: %v", len(m), err)
+					}
+				}
+			}
+
+			enc, _ := NewEncoder()
+			p, _ := NewParser()
+			enc.SetCompressor(comp)
+			p.SetCompressor(comp)
+			var wire []byte
+			var items []BatchItem
+			for i, m := range payloads {
+				if wire, err = enc.AppendSingle(wire, uint16(i), m, FlagCompress); err != nil {
+					t.Fatal(err)
+				}
+				items = append(items, BatchItem{Api: uint16(i), Payload: m})
+			}
+			if wire, err = enc.AppendBatch(wire, items); err != nil {
+				t.Fatal(err)
+			}
+			var got []BatchItem
+			n, err := p.Parse(wire, func(api uint16, b []byte) error {
+				got = append(got, BatchItem{Api: api, Payload: bytes.Clone(b)})
+				return nil
+			})
+			if err != nil || n != len(wire) {
+				t.Fatalf("Parse n=%d/%d err=%v", n, len(wire), err)
+			}
+			want := append(slices.Clone(items), items...)
+			if len(got) != len(want) {
+				t.Fatalf("got %d messages, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i].Api != want[i].Api || !bytes.Equal(got[i].Payload, want[i].Payload) {
+					t.Fatalf("message %d: api %d len %d, want api %d len %d",
+						i, got[i].Api, len(got[i].Payload), want[i].Api, len(want[i].Payload))
+				}
+			}
+		})
+	}
+}
+
+func TestLookupCompressor(t *testing.T) {
+	def, err := LookupCompressor("")
+	if err != nil || def.Name() != DefaultCompression {
+		t.Fatalf("LookupCompressor(\"\") = %v, %v", def, err)
+	}
+	if _, err := LookupCompressor("lz4"); !errors.Is(err, ErrUnknownCompressor) {
+		t.Fatalf("unknown name: err=%v, want ErrUnknownCompressor", err)
+	}
+	names := Compressors()
+	if !slices.IsSorted(names) {
+		t.Fatalf("Compressors() not sorted: %v", names)
+	}
+	for _, n := range []string{"zstd", "zstd-best", "s2", "snappy", "deflate"} {
+		if !slices.Contains(names, n) {
+			t.Errorf("built-in %q not registered: %v", n, names)
+		}
+	}
+}
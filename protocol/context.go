@@ -0,0 +1,171 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 上下文接管（context takeover）：启用后批量帧不再各自独立压缩，而是写入连接上长期存在的
+// 流式 zstd 编码器，每批以一次 Flush 结束，可引用窗口内此前的全部流量
+// （类似不带 no_context_takeover 的 permessage-deflate）。帧头以 Batched=1、Compressed=0 标记，
+// 帧体为 uvarint(批前镜像长度) | crc32c(批前镜像, 4B BE) | 流式 zstd 块；zstd 块本身不带校验，
+// 历史失步时可能“成功”解出错误内容，由 crc 检出。单帧与预压缩/共享帧仍为无状态压缩，
+// 超过窗口的大批量也回退为无状态批量帧（它们会冲掉整个历史，且收益有限）。
+// 接收方必须按序解码全部上下文帧，任何一帧缺失或损坏都会使后续帧无法解码（ErrContextBroken）。
+//
+// 上下文状态按实际流量计量（ContextMemory）：编解码器的固定开销（首个上下文帧时才创建）、已保留的历史
+// （不超过窗口）及编码暂存的容量。连接据此执行每连接的内存上限：超出的一端以 Encoder.ResetContext
+// 停止发送上下文帧并发出 ApiContextReset；对端收到后以 Parser.ResetContext 释放解码状态，
+// 并同样停止发送、回以 ApiContextReset。两个方向各发送一次，此后均为无状态批量帧。
+
+const (
+	MinContextWindow = 1 << 10
+	MaxContextWindow = 8 << 20
+)
+
+var (
+	ErrContextWindow = errors.New("protocol: context window must be a power of two in [1KiB, 8MiB]")
+	ErrContextBroken = errors.New("protocol: compression context out of sync")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ValidContextWindow 报告 w 是否为合法的上下文窗口。
+func ValidContextWindow(w int) bool {
+	return w >= MinContextWindow && w <= MaxContextWindow && w&(w-1) == 0
+}
+
+// contextStateBase 为单个方向的流式编码器或解码器在历史之外的固定开销（哈希表、块缓冲等）。
+const contextStateBase = 256 << 10
+
+// streamEncoder 为发送方向的流式上下文；hist 为已保留的历史字节数。
+type streamEncoder struct {
+	window int
+	enc    *zstd.Encoder
+	out    bytes.Buffer
+	hist   int
+}
+
+func (s *streamEncoder) memory() int {
+	if s.enc == nil {
+		return 0
+	}
+	return contextStateBase + s.hist + s.out.Cap()
+}
+
+func (s *streamEncoder) encode(dst, src []byte) ([]byte, error) {
+	if s.enc == nil {
+		enc, err := zstd.NewWriter(&s.out, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(s.window),
+			zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithLowerEncoderMem(true))
+		if err != nil {
+			return nil, err
+		}
+		s.enc = enc
+	}
+	s.out.Reset()
+	if _, err := s.enc.Write(src); err != nil {
+		return nil, err
+	}
+	if err := s.enc.Flush(); err != nil {
+		return nil, err
+	}
+	s.hist = min(s.hist+len(src), s.window)
+	dst = binary.AppendUvarint(dst, uint64(len(src)))
+	dst = binary.BigEndian.AppendUint32(dst, crc32.Checksum(src, castagnoli))
+	return append(dst, s.out.Bytes()...), nil
+}
+
+func (s *streamEncoder) close() {
+	if s.enc != nil {
+		_ = s.enc.Close()
+	}
+}
+
+// streamDecoder 为接收方向的流式上下文；in 为当前帧尚未被解码器读取的字节，hist 为已保留的历史字节数。
+type streamDecoder struct {
+	window int
+	dec    *zstd.Decoder
+	in     []byte
+	hist   int
+	broken bool
+}
+
+func (s *streamDecoder) memory() int {
+	if s.dec == nil {
+		return 0
+	}
+	return contextStateBase + s.hist
+}
+
+func (s *streamDecoder) Read(p []byte) (int, error) {
+	if len(s.in) == 0 {
+		// 当前帧的块已读完仍需数据：帧不完整或两端失步
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, s.in)
+	s.in = s.in[n:]
+	return n, nil
+}
+
+// decode 解码一个上下文帧体并将批前镜像追加到 dst，max>0 时为批前镜像的长度上限。
+func (s *streamDecoder) decode(dst, body []byte, max int) ([]byte, error) {
+	if s.broken {
+		return nil, ErrContextBroken
+	}
+	out, err := s.decodeFrame(dst, body, max)
+	if err != nil {
+		s.broken = true
+		if err == ErrDecompressedTooLarge {
+			return nil, err
+		}
+		return nil, ErrContextBroken
+	}
+	return out, nil
+}
+
+func (s *streamDecoder) decodeFrame(dst, body []byte, max int) ([]byte, error) {
+	n, k := binary.Uvarint(body)
+	if k <= 0 || len(body) < k+4 {
+		return nil, ErrContextBroken
+	}
+	if max > 0 && n > uint64(max) {
+		return nil, ErrDecompressedTooLarge
+	}
+	sum := binary.BigEndian.Uint32(body[k:])
+	if s.dec == nil {
+		dec, err := zstd.NewReader(s, zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxWindow(uint64(s.window)), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return nil, err
+		}
+		s.dec = dec
+	}
+	s.in = body[k+4:]
+	// 按实际解出的字节增长缓冲，而非信任声明的长度一次分配
+	start := len(dst)
+	for uint64(len(dst)-start) < n {
+		chunk := int(min(n-uint64(len(dst)-start), 64<<10))
+		dst = grow(dst, chunk)
+		m, err := io.ReadFull(s.dec, dst[len(dst):len(dst)+chunk])
+		dst = dst[:len(dst)+m]
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(s.in) != 0 || crc32.Checksum(dst[start:], castagnoli) != sum {
+		return nil, ErrContextBroken
+	}
+	s.hist = min(s.hist+int(n), s.window)
+	return dst, nil
+}
+
+func (s *streamDecoder) close() {
+	if s.dec != nil {
+		s.dec.Close()
+	}
+}
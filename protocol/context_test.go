@@ -0,0 +1,155 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// ctxBatch 返回以 seq 区分内容、便于历史引用的单条批量项。
+func ctxBatch(seq int) []BatchItem {
+	return []BatchItem{{Api: uint16(seq), Payload: bytes.Repeat([]byte(fmt.Sprintf("item %d;", seq)), 256)}}
+}
+
+// TestContextMemoryReset 校验 ContextMemory 随流量增长且不超过窗口加固定开销，
+// ResetContext 之后批量帧为无状态帧，而解析方重置后拒绝上下文帧。
+func TestContextMemoryReset(t *testing.T) {
+	const window = 4 << 10
+	enc, _ := NewEncoder()
+	p, _ := NewParser()
+	if err := enc.SetContext(window); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetContext(window); err != nil {
+		t.Fatal(err)
+	}
+	if enc.ContextMemory() != 0 || p.ContextMemory() != 0 {
+		t.Fatalf("memory before first frame: enc %d, parser %d", enc.ContextMemory(), p.ContextMemory())
+	}
+	var prev int
+	for i := range 8 {
+		fr, err := enc.AppendBatch(nil, ctxBatch(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f, _, _ := PeekFrame(fr); !f.Batched || f.Compressed {
+			t.Fatalf("frame %d is not a context frame", i)
+		}
+		if _, err := p.Parse(fr, func(uint16, []byte) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		m := p.ContextMemory()
+		if m < prev || m > contextStateBase+window {
+			t.Fatalf("frame %d: parser memory %d (prev %d)", i, m, prev)
+		}
+		prev = m
+	}
+	if prev != contextStateBase+window || enc.ContextMemory() < prev {
+		t.Fatalf("memory after filling the window: enc %d, parser %d", enc.ContextMemory(), prev)
+	}
+
+	enc.ResetContext()
+	if enc.ContextMemory() != 0 {
+		t.Fatalf("encoder memory %d after reset", enc.ContextMemory())
+	}
+	stateless, err := enc.AppendBatch(nil, ctxBatch(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, _, _ := PeekFrame(stateless); !f.Batched || !f.Compressed {
+		t.Fatal("batch after ResetContext is not a stateless frame")
+	}
+	// 重置前编出的上下文帧
+	ctxFrame, _ := func() ([]byte, error) {
+		e, _ := NewEncoder()
+		_ = e.SetContext(window)
+		return e.AppendBatch(nil, ctxBatch(0))
+	}()
+
+	p.ResetContext()
+	if p.ContextMemory() != 0 {
+		t.Fatalf("parser memory %d after reset", p.ContextMemory())
+	}
+	var got []uint16
+	if _, err := p.Parse(stateless, func(api uint16, _ []byte) error { got = append(got, api); return nil }); err != nil || len(got) != 1 || got[0] != 8 {
+		t.Fatalf("stateless batch after reset: got %v, err %v", got, err)
+	}
+	if _, err := parseErr(t, p, ctxFrame); !errors.Is(err, ErrContextBroken) {
+		t.Fatalf("context frame after reset: err=%v, want ErrContextBroken", err)
+	}
+}
+
+// TestContextFrames 校验上下文帧跨多批按序解码、后续批次引用历史而更小，
+// 缺失或篡改任一帧后其后的上下文帧返回 ErrContextBroken。
+func TestContextFrames(t *testing.T) {
+	const window = 64 << 10
+	enc, _ := NewEncoder()
+	if err := enc.SetContext(window); err != nil {
+		t.Fatal(err)
+	}
+	stateless, _ := NewEncoder()
+	var frames [][]byte
+	for i := range 6 {
+		fr, err := enc.AppendBatch(nil, ctxBatch(i%2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f, _, _ := PeekFrame(fr); !f.Batched || f.Compressed {
+			t.Fatalf("frame %d is not a context frame", i)
+		}
+		frames = append(frames, fr)
+	}
+	ref, _ := stateless.AppendBatch(nil, ctxBatch(1))
+	if len(frames[3]) >= len(ref) {
+		t.Errorf("repeated batch: context frame %d bytes, stateless %d", len(frames[3]), len(ref))
+	}
+
+	newParser := func() *Parser {
+		p, _ := NewParser()
+		if err := p.SetContext(window); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	p := newParser()
+	for i, fr := range frames {
+		var got []BatchItem
+		if _, err := p.Parse(fr, func(api uint16, b []byte) error {
+			got = append(got, BatchItem{Api: api, Payload: bytes.Clone(b)})
+			return nil
+		}); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		want := ctxBatch(i % 2)
+		if len(got) != 1 || got[0].Api != want[0].Api || !bytes.Equal(got[0].Payload, want[0].Payload) {
+			t.Fatalf("frame %d decoded wrongly", i)
+		}
+	}
+
+	// 丢弃 frames[2]
+	p = newParser()
+	nop := func(uint16, []byte) error { return nil }
+	for i, fr := range frames[:2] {
+		if _, err := p.Parse(fr, nop); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+	}
+	if _, err := parseErr(t, p, frames[3]); !errors.Is(err, ErrContextBroken) {
+		t.Fatalf("frame after a dropped frame: err=%v, want ErrContextBroken", err)
+	}
+
+	// 篡改负载（crc 检出）
+	p = newParser()
+	bad := bytes.Clone(frames[0])
+	bad[len(bad)-1] ^= 0xff
+	if _, err := parseErr(t, p, bad); !errors.Is(err, ErrContextBroken) {
+		t.Fatalf("tampered frame: err=%v, want ErrContextBroken", err)
+	}
+
+	// 未启用上下文的解析方
+	p, _ = NewParser()
+	if _, err := parseErr(t, p, frames[0]); !errors.Is(err, ErrContextBroken) {
+		t.Fatalf("parser without context: err=%v, want ErrContextBroken", err)
+	}
+}
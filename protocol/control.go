@@ -0,0 +1,29 @@
+package protocol
+
+import "errors"
+
+// 控制帧：占用保留的 api 段 [ApiControlBase, 0xFFFF]，以普通单帧传输，
+// 由框架在两端拦截处理，不交付业务回调。
+const (
+	ApiControlBase uint16 = 0xFF00
+	// ApiGoAway 通知对端本端即将关闭，负载为可选的 UTF-8 原因。
+	ApiGoAway uint16 = 0xFFFF
+	// ApiPing 心跳探测，负载为发送方自定义的 8 字节时间戳（BE），对端原样回 ApiPong。
+	ApiPing uint16 = 0xFFFE
+	// ApiPong 心跳应答，负载与对应 ApiPing 相同，发送方据此测量 RTT。
+	ApiPong uint16 = 0xFFFD
+	// ApiHandshake 承载连接建立时的密钥交换消息，负载首字节为消息类型。
+	ApiHandshake uint16 = 0xFFFC
+	// ApiContextReset 通知对端本端已停止发送上下文帧并释放了流式上下文（见 Encoder.ResetContext），负载为空；
+	// 对端随之释放解码状态，尚未发送时同样停止上下文接管并回以 ApiContextReset。
+	ApiContextReset uint16 = 0xFFFB
+)
+
+// ErrUnknownControl 表示收到控制帧段内未定义的 api；业务消息不得使用该段，收到时连接应关闭。
+var ErrUnknownControl = errors.New("protocol: unknown control frame")
+
+// PingPayloadLen 为 ping/pong 负载长度。
+const PingPayloadLen = 8
+
+// IsControl 报告 api 是否属于保留的控制帧段。
+func IsControl(api uint16) bool { return api >= ApiControlBase }
@@ -0,0 +1,117 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Dict 为一份训练好的 zstd 字典（dict.BuildZstdDict 或 cmd/gio-dict 的输出），
+// 用于压缩 api ∈ [Lo, Hi] 的消息。字典自带的 ID 写入每个 zstd 帧头，解压时据此选择字典。
+type Dict struct {
+	Lo, Hi uint16
+	Data   []byte
+}
+
+// APICompressor 可由 Compressor 额外实现：按消息的 api 选择压缩参数（如字典）。
+// Encoder 压缩单帧时传入其 api，压缩批量帧时传入首条消息的 api。
+type APICompressor interface {
+	CompressAPI(dst, src []byte, api uint16) ([]byte, error)
+}
+
+var ErrBadDict = errors.New("protocol: invalid zstd dictionary")
+
+// DictCompressorName 返回 ID 为 id 的字典组注册的算法名，两端以此名在握手中协商
+// （或各自配置为 CompressionAlgo），即在连接建立时约定所用的字典组。
+func DictCompressorName(id uint32) string { return fmt.Sprintf("zstd-dict-%d", id) }
+
+// dictCompressor 为带字典的 zstd：按 api 落入的第一个区间选择字典，都不落入时不用字典。
+// 解码器加载全部字典，按帧头的字典 ID 选择。
+type dictCompressor struct {
+	name   string
+	ranges []dictRange
+	plain  sync.Pool
+	dec    *zstdDecoders
+}
+
+type dictRange struct {
+	lo, hi uint16
+	pool   *sync.Pool
+}
+
+// NewDictCompressor 以 id 标识的字典组创建 zstd 压缩算法，名为 DictCompressorName(id)，
+// 须经 RegisterCompressor 注册后才能由 CompressionAlgo 或握手选用；两端须加载相同的字典组。
+// 各字典的内嵌 ID 须互不相同，dicts 按顺序匹配 api 区间。
+func NewDictCompressor(id uint32, level zstd.EncoderLevel, dicts ...Dict) (Compressor, error) {
+	d := &dictCompressor{name: DictCompressorName(id)}
+	d.plain.New = func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+		return enc
+	}
+	seen := make(map[uint32]bool, len(dicts))
+	raw := make([][]byte, 0, len(dicts))
+	for _, dc := range dicts {
+		info, err := zstd.InspectDictionary(dc.Data)
+		if err != nil || info.ID() == 0 || dc.Lo > dc.Hi {
+			return nil, ErrBadDict
+		}
+		if !seen[info.ID()] {
+			seen[info.ID()] = true
+			raw = append(raw, dc.Data)
+		}
+		data := dc.Data
+		pool := &sync.Pool{New: func() any {
+			enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderDict(data))
+			return enc
+		}}
+		// 提前创建一个编码器以校验字典
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderDict(data))
+		if err != nil {
+			return nil, ErrBadDict
+		}
+		pool.Put(enc)
+		d.ranges = append(d.ranges, dictRange{lo: dc.Lo, hi: dc.Hi, pool: pool})
+	}
+	d.dec = &zstdDecoders{opts: []zstd.DOption{zstd.WithDecoderDicts(raw...)}}
+	dec, err := zstd.NewReader(nil, d.dec.opts...)
+	if err != nil {
+		return nil, ErrBadDict
+	}
+	d.dec.pool(0).Put(dec)
+	return d, nil
+}
+
+func (d *dictCompressor) Name() string { return d.name }
+
+// Compress 不使用字典；需按 api 选择字典时调用 CompressAPI。
+func (d *dictCompressor) Compress(dst, src []byte) ([]byte, error) {
+	return encodeWith(&d.plain, dst, src), nil
+}
+
+func (d *dictCompressor) CompressAPI(dst, src []byte, api uint16) ([]byte, error) {
+	for _, r := range d.ranges {
+		if api >= r.lo && api <= r.hi {
+			return encodeWith(r.pool, dst, src), nil
+		}
+	}
+	return encodeWith(&d.plain, dst, src), nil
+}
+
+func (d *dictCompressor) decodedSize(src []byte) int { return zstdContentSize(src) }
+
+func (d *dictCompressor) Decompress(dst, src []byte) ([]byte, error) {
+	return d.dec.decodeAll(dst, src, 0)
+}
+
+func (d *dictCompressor) DecompressLimit(dst, src []byte, max int) ([]byte, error) {
+	return d.dec.decodeAll(dst, src, max)
+}
+
+func encodeWith(pool *sync.Pool, dst, src []byte) []byte {
+	enc := pool.Get().(*zstd.Encoder)
+	dst = enc.EncodeAll(src, dst)
+	pool.Put(enc)
+	return dst
+}
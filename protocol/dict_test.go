@@ -0,0 +1,154 @@
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+// dictSamples 返回结构相同、字段取值不同的样本，kind 区分两类消息。
+func dictSamples(kind string, n int) [][]byte {
+	out := make([][]byte, n)
+	for i := range out {
+		out[i] = fmt.Appendf(nil, `{"kind":%q,"player_id":%d,"position":{"x":%d,"y":%d},"inventory":["sword","shield","potion-%d"],"guild":"guild-%d"}`,
+			kind, 100000+i*7919, i%640, i%480, i%13, i%29)
+	}
+	return out
+}
+
+func trainDict(t *testing.T, id uint32, samples [][]byte) []byte {
+	t.Helper()
+	d, err := dict.BuildZstdDict(samples, dict.Options{MaxDictSize: 4 << 10, HashBytes: 6, ZstdDictID: id, ZstdLevel: zstd.SpeedDefault})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// frameDictID 返回 zstd 帧头中的字典 ID。
+func frameDictID(t *testing.T, b []byte) uint32 {
+	t.Helper()
+	var h zstd.Header
+	if err := h.Decode(b); err != nil {
+		t.Fatal(err)
+	}
+	return h.DictionaryID
+}
+
+// TestDictCompressor 校验按 api 区间选择字典、字典 ID 写入帧头、压缩结果小于不用字典，且经帧往返。
+func TestDictCompressor(t *testing.T) {
+	move, chat := dictSamples("move", 500), dictSamples("chat", 500)
+	dMove, dChat := trainDict(t, 11, move), trainDict(t, 12, chat)
+	comp, err := NewDictCompressor(7, zstd.SpeedDefault, Dict{Lo: 100, Hi: 199, Data: dMove}, Dict{Lo: 200, Hi: 299, Data: dChat})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comp.Name() != DictCompressorName(7) {
+		t.Fatalf("Name() = %q", comp.Name())
+	}
+	ac := comp.(APICompressor)
+	msg := dictSamples("move", 501)[500]
+	plain, _ := comp.Compress(nil, msg)
+	for _, tc := range []struct {
+		api uint16
+		id  uint32
+	}{{150, 11}, {100, 11}, {299, 12}, {99, 0}, {300, 0}} {
+		z, err := ac.CompressAPI(nil, msg, tc.api)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := frameDictID(t, z); got != tc.id {
+			t.Errorf("api %d: dict id %d, want %d", tc.api, got, tc.id)
+		}
+		out, err := comp.Decompress(nil, z)
+		if err != nil || !bytes.Equal(out, msg) {
+			t.Fatalf("api %d: Decompress: %v", tc.api, err)
+		}
+		if tc.id == 11 && len(z) >= len(plain) {
+			t.Errorf("api %d: %d bytes with dict, %d without", tc.api, len(z), len(plain))
+		}
+	}
+
+	// 单帧按自身 api、批量帧按首条消息的 api 选择字典
+	enc, _ := NewEncoder()
+	p, _ := NewParser()
+	enc.SetCompressor(comp)
+	p.SetCompressor(comp)
+	single, _ := enc.AppendSingle(nil, 250, msg, FlagCompress)
+	if f, _, _ := PeekFrame(single); frameDictID(t, f.Body()) != 12 {
+		t.Error("single frame for api 250 does not use dict 12")
+	}
+	batch, _ := enc.AppendBatch(nil, []BatchItem{{Api: 120, Payload: msg}, {Api: 250, Payload: msg}})
+	if f, _, _ := PeekFrame(batch); frameDictID(t, f.Body()) != 11 {
+		t.Error("batch led by api 120 does not use dict 11")
+	}
+	var got []uint16
+	wire := append(single, batch...)
+	if n, err := p.Parse(wire, func(api uint16, b []byte) error {
+		if !bytes.Equal(b, msg) {
+			t.Errorf("api %d: payload mismatch", api)
+		}
+		got = append(got, api)
+		return nil
+	}); err != nil || n != len(wire) || len(got) != 3 {
+		t.Fatalf("Parse n=%d/%d err=%v apis=%v", n, len(wire), err, got)
+	}
+}
+
+// TestDictMismatch 校验对端未加载帧头所示的字典或加载了同 ID 的不同字典时解析失败，而非交付错误内容。
+func TestDictMismatch(t *testing.T) {
+	move := dictSamples("move", 500)
+	dMove := trainDict(t, 11, move)
+	sender, err := NewDictCompressor(7, zstd.SpeedDefault, Dict{Lo: 0, Hi: 0xFEFF, Data: dMove})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := NewEncoder()
+	enc.SetCompressor(sender)
+	fr, _ := enc.AppendSingle(nil, 1, dictSamples("move", 501)[500], FlagCompress)
+
+	other := trainDict(t, 12, dictSamples("chat", 500))
+	sameID := trainDict(t, 11, dictSamples("chat", 500))
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{{"missing id", other}, {"same id, different content", sameID}} {
+		peer, err := NewDictCompressor(7, zstd.SpeedDefault, Dict{Lo: 0, Hi: 0xFEFF, Data: tc.data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, _ := NewParser()
+		p.SetCompressor(peer)
+		if _, err := parseErr(t, p, fr); err == nil {
+			t.Errorf("%s: frame accepted", tc.name)
+		}
+	}
+	// 不带字典的 zstd 同样拒绝
+	p, _ := NewParser()
+	if _, err := parseErr(t, p, fr); err == nil {
+		t.Error("plain zstd accepted a dictionary frame")
+	}
+}
+
+func TestNewDictCompressorInvalid(t *testing.T) {
+	d := trainDict(t, 11, dictSamples("move", 500))
+	// 字典格式：4 字节魔数之后为 4 字节小端 ID
+	noID := bytes.Clone(d)
+	clear(noID[4:8])
+	for _, tc := range []struct {
+		name string
+		dict Dict
+	}{
+		{"garbage", Dict{Hi: 10, Data: []byte("not a dictionary")}},
+		{"empty", Dict{Hi: 10}},
+		{"inverted range", Dict{Lo: 10, Hi: 1, Data: d}},
+		{"zero id", Dict{Hi: 10, Data: noID}},
+	} {
+		if _, err := NewDictCompressor(1, zstd.SpeedDefault, tc.dict); err != ErrBadDict {
+			t.Errorf("%s: err=%v, want ErrBadDict", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package protocol
+
+import "io"
+
+// FrameReader 与 FrameWriter 在标准库的 io.Reader/io.Writer（net.Conn、tls.Conn、管道、文件等）上
+// 读写 gio 线路格式，供不运行 epoll 服务端的程序使用。两者均非并发安全。
+// 缺省上限为 DefaultLimits，且帧长度不超过 MaxDecompressed，读取方据此约束缓冲的增长。
+
+// streamLimits 返回 FrameReader/FrameWriter 的缺省上限。
+func streamLimits() Limits {
+	l := DefaultLimits()
+	l.MaxFrame = l.MaxDecompressed
+	return l
+}
+
+// minReadBuf 为 FrameReader 读缓冲的初始容量及单次读取的最小空间。
+const minReadBuf = 4 << 10
+
+type rxItem struct {
+	api uint16
+	ref Ref
+}
+
+// FrameReader 从 io.Reader 逐条读取消息，缓冲跨多次 Read 的半帧。
+// 控制帧同样返回，由调用方处理（见 IsControl）。
+type FrameReader struct {
+	r   io.Reader
+	prs *Parser
+	buf []byte
+	off int
+	// 已解析、尚未返回的消息（批量帧）及上一次返回的消息
+	q   []rxItem
+	qh  int
+	cur Ref
+	cb  func(api uint16, payload []byte) error
+	// err 为终止错误；rerr 为与数据一同返回、待缓冲数据解析完后再报告的读错误
+	err  error
+	rerr error
+}
+
+// NewFrameReader 返回从 r 读取消息的 FrameReader，使用默认压缩算法与缺省上限。
+func NewFrameReader(r io.Reader) *FrameReader {
+	prs, _ := NewParser()
+	prs.SetLimits(streamLimits())
+	fr := &FrameReader{r: r, prs: prs}
+	fr.cb = fr.onMessage
+	return fr
+}
+
+// Parser 返回底层解析器，用于设置压缩算法、上下文接管、帧认证、上限或缓冲池；
+// 须在首次 ReadMessage 之前设置，或与对端约定的切换点一致。
+func (fr *FrameReader) Parser() *Parser { return fr.prs }
+
+// onMessage 保留解析出的消息：位于池化解压缓冲的增加引用，指向读缓冲的（未压缩单帧）
+// 直接引用，读缓冲在该消息返回之前不会被移动或覆盖。
+func (fr *FrameReader) onMessage(api uint16, payload []byte) error {
+	ref := Ref{data: payload}
+	if fr.prs.cur != nil {
+		ref = fr.prs.Retain()
+	}
+	fr.q = append(fr.q, rxItem{api: api, ref: ref})
+	return nil
+}
+
+// ReadMessage 返回下一条消息；msg 在下一次调用 ReadMessage 或 Close 前有效。
+// 在帧边界上读到 EOF 时返回 io.EOF，帧不完整时返回 io.ErrUnexpectedEOF；
+// 解析错误（违反上限、认证失败等）之后流无法继续，其后的调用均返回同一错误。
+func (fr *FrameReader) ReadMessage() (api uint16, msg []byte, err error) {
+	fr.cur.Release()
+	fr.cur = Ref{}
+	for {
+		if fr.qh < len(fr.q) {
+			it := fr.q[fr.qh]
+			fr.q[fr.qh] = rxItem{}
+			fr.qh++
+			fr.cur = it.ref
+			return it.api, it.ref.Bytes(), nil
+		}
+		fr.q, fr.qh = fr.q[:0], 0
+		if fr.err != nil {
+			return 0, nil, fr.err
+		}
+		n, err := fr.prs.ParseFrame(fr.buf[fr.off:], fr.cb)
+		fr.off += n
+		if err != nil {
+			// 帧内已解析的消息先行返回
+			fr.err = err
+			continue
+		}
+		if n == 0 {
+			fr.err = fr.fill()
+		}
+	}
+}
+
+// fill 读取一次到缓冲末尾；已消费的前缀先行移除，空间不足时扩容。
+func (fr *FrameReader) fill() error {
+	if err := fr.rerr; err != nil {
+		if err == io.EOF && len(fr.buf) > fr.off {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if fr.off > 0 {
+		fr.buf = fr.buf[:copy(fr.buf, fr.buf[fr.off:])]
+		fr.off = 0
+	}
+	if cap(fr.buf)-len(fr.buf) < minReadBuf {
+		fr.buf = append(fr.buf, make([]byte, max(minReadBuf, cap(fr.buf)))...)[:len(fr.buf)]
+	}
+	n, err := fr.r.Read(fr.buf[len(fr.buf):cap(fr.buf)])
+	fr.buf = fr.buf[:len(fr.buf)+n]
+	fr.rerr = err
+	if n > 0 || err == nil {
+		return nil
+	}
+	return fr.fill()
+}
+
+// Close 释放缓冲的消息与解析器状态，不关闭底层的 io.Reader。
+func (fr *FrameReader) Close() error {
+	fr.cur.Release()
+	fr.cur = Ref{}
+	for _, it := range fr.q[fr.qh:] {
+		it.ref.Release()
+	}
+	fr.q, fr.qh = nil, 0
+	return fr.prs.Close()
+}
+
+// FrameWriter 将消息编码为帧写入 io.Writer，帧先缓冲，达到阈值或 Flush 时写出。
+type FrameWriter struct {
+	w       io.Writer
+	enc     *Encoder
+	aead    *FrameAEAD
+	lim     Limits
+	buf     []byte
+	scratch []byte
+	err     error
+}
+
+// flushThreshold 为 FrameWriter 缓冲达到后自动写出的字节数。
+const flushThreshold = 64 << 10
+
+// NewFrameWriter 返回写入 w 的 FrameWriter，使用默认压缩算法与缺省上限。
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	enc, _ := NewEncoder()
+	return &FrameWriter{w: w, enc: enc, lim: streamLimits()}
+}
+
+// Encoder 返回底层编码器，用于设置压缩算法或上下文接管。
+func (fw *FrameWriter) Encoder() *Encoder { return fw.enc }
+
+// SetAEAD 使其后写出的每一帧都以 a 密封（认证帧），对端 Parser 须以对应状态 SetAEAD。
+func (fw *FrameWriter) SetAEAD(a *FrameAEAD) { fw.aead = a }
+
+// SetLimits 设置写出前检查的上限，应与对端解析器一致；超出时写入返回对应的错误且不写出该帧。
+func (fw *FrameWriter) SetLimits(l Limits) { fw.lim = l }
+
+// WriteMessage 写入一条不压缩的消息。
+func (fw *FrameWriter) WriteMessage(api uint16, msg []byte) error {
+	return fw.writeSingle(api, msg, 0)
+}
+
+// WriteCompressed 以编码器的压缩算法压缩后写入一条消息。
+func (fw *FrameWriter) WriteCompressed(api uint16, msg []byte) error {
+	return fw.writeSingle(api, msg, FlagCompress)
+}
+
+func (fw *FrameWriter) writeSingle(api uint16, msg []byte, flags Flags) error {
+	if fw.lim.MaxMessage > 0 && len(msg) > fw.lim.MaxMessage {
+		return ErrMessageTooLarge
+	}
+	if flags&FlagCompress != 0 && fw.lim.MaxDecompressed > 0 && len(msg) > fw.lim.MaxDecompressed {
+		return ErrDecompressedTooLarge
+	}
+	frame, err := fw.enc.AppendSingle(fw.scratch[:0], api, msg, flags)
+	fw.scratch = frame[:0]
+	if err != nil {
+		return err
+	}
+	return fw.writeFrame(frame)
+}
+
+// WriteBatch 将一批消息写为一个批量帧。
+func (fw *FrameWriter) WriteBatch(items []BatchItem) error {
+	if fw.lim.MaxBatchMsgs > 0 && len(items) > fw.lim.MaxBatchMsgs {
+		return ErrBatchTooLarge
+	}
+	pre := uvarintLen(uint64(len(items)))
+	for _, it := range items {
+		if fw.lim.MaxMessage > 0 && len(it.Payload) > fw.lim.MaxMessage {
+			return ErrMessageTooLarge
+		}
+		pre += 2 + uvarintLen(uint64(len(it.Payload))) + len(it.Payload)
+	}
+	if fw.lim.MaxDecompressed > 0 && pre > fw.lim.MaxDecompressed {
+		return ErrDecompressedTooLarge
+	}
+	frame, err := fw.enc.AppendBatch(fw.scratch[:0], items)
+	fw.scratch = frame[:0]
+	if err != nil {
+		return err
+	}
+	return fw.writeFrame(frame)
+}
+
+// writeFrame 检查帧长度后（密封并）追加到缓冲，超过阈值时写出。
+func (fw *FrameWriter) writeFrame(frame []byte) error {
+	if fw.err != nil {
+		return fw.err
+	}
+	f, _, err := PeekFrame(frame)
+	if err != nil {
+		return err
+	}
+	length := f.Length
+	if fw.aead != nil {
+		length += fw.aead.Overhead()
+	}
+	if fw.lim.MaxFrame > 0 && length > fw.lim.MaxFrame {
+		return ErrFrameTooLarge
+	}
+	if fw.aead != nil {
+		if fw.buf, err = fw.aead.Seal(fw.buf, frame); err != nil {
+			return err
+		}
+	} else {
+		fw.buf = append(fw.buf, frame...)
+	}
+	if len(fw.buf) >= flushThreshold {
+		return fw.Flush()
+	}
+	return nil
+}
+
+// Buffered 返回尚未写出的字节数。
+func (fw *FrameWriter) Buffered() int { return len(fw.buf) }
+
+// Flush 写出缓冲的全部帧。写出失败后流无法继续，其后的写入均返回同一错误。
+func (fw *FrameWriter) Flush() error {
+	if fw.err != nil {
+		return fw.err
+	}
+	if len(fw.buf) == 0 {
+		return nil
+	}
+	n, err := fw.w.Write(fw.buf)
+	if err == nil && n < len(fw.buf) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		fw.err = err
+		return err
+	}
+	fw.buf = fw.buf[:0]
+	return nil
+}
+
+// Close 释放编码器状态，不写出缓冲也不关闭底层的 io.Writer。
+func (fw *FrameWriter) Close() error { return fw.enc.Close() }
+
+func uvarintLen(x uint64) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
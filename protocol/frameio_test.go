@@ -0,0 +1,172 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+type ioMsg struct {
+	api   uint16
+	msg   []byte
+	batch bool
+	comp  bool
+}
+
+// ioMsgs 覆盖未压缩、压缩、批量及超过自动写出阈值的消息。
+func ioMsgs() []ioMsg {
+	return []ioMsg{
+		{api: 1, msg: []byte("hello")},
+		{api: 2, msg: nil},
+		{api: 3, msg: benchPayload(5000), comp: true},
+		{api: 4, msg: benchPayload(300), batch: true},
+		{api: 5, msg: []byte("batched"), batch: true},
+		{api: 6, msg: bytes.Repeat([]byte{6}, 200<<10)},
+		{api: 7, msg: benchPayload(100 << 10), comp: true},
+		{api: ApiPing, msg: make([]byte, PingPayloadLen)},
+	}
+}
+
+// writeMsgs 依次写入 msgs（相邻的批量消息合为一个批量帧），写完后 Flush 并关闭 w。
+func writeMsgs(fw *FrameWriter, w io.Closer, msgs []ioMsg) error {
+	defer w.Close()
+	for i := 0; i < len(msgs); i++ {
+		m := msgs[i]
+		var err error
+		switch {
+		case m.batch:
+			var items []BatchItem
+			for ; i < len(msgs) && msgs[i].batch; i++ {
+				items = append(items, BatchItem{Api: msgs[i].api, Payload: msgs[i].msg})
+			}
+			i--
+			err = fw.WriteBatch(items)
+		case m.comp:
+			err = fw.WriteCompressed(m.api, m.msg)
+		default:
+			err = fw.WriteMessage(m.api, m.msg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return fw.Flush()
+}
+
+// TestFrameIORoundTrip 校验 FrameWriter 与 FrameReader 经 net.Pipe 的往返，含认证帧与上下文接管。
+func TestFrameIORoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		setup func(fw *FrameWriter, fr *FrameReader)
+	}{
+		{"plain", func(*FrameWriter, *FrameReader) {}},
+		{"aead", func(fw *FrameWriter, fr *FrameReader) {
+			tx, rx := aeadPair(t)
+			fw.SetAEAD(tx)
+			fr.Parser().SetAEAD(rx)
+		}},
+		{"context", func(fw *FrameWriter, fr *FrameReader) {
+			_ = fw.Encoder().SetContext(64 << 10)
+			_ = fr.Parser().SetContext(64 << 10)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := net.Pipe()
+			defer b.Close()
+			fw, fr := NewFrameWriter(a), NewFrameReader(b)
+			defer fw.Close()
+			defer fr.Close()
+			tc.setup(fw, fr)
+			msgs := ioMsgs()
+			werr := make(chan error, 1)
+			go func() { werr <- writeMsgs(fw, a, msgs) }()
+			for i, m := range msgs {
+				api, msg, err := fr.ReadMessage()
+				if err != nil {
+					t.Fatalf("msg %d: %v", i, err)
+				}
+				if api != m.api || !bytes.Equal(msg, m.msg) {
+					t.Fatalf("msg %d: api %d len %d, want api %d len %d", i, api, len(msg), m.api, len(m.msg))
+				}
+			}
+			if _, _, err := fr.ReadMessage(); err != io.EOF {
+				t.Fatalf("after the last message: %v, want io.EOF", err)
+			}
+			if err := <-werr; err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// TestFrameIOAuthFailed 校验序号与发送方错位的读取方以 ErrAuthFailed 终止，其后的调用返回同一错误。
+func TestFrameIOAuthFailed(t *testing.T) {
+	tx, _ := aeadPair(t)
+	var wire bytes.Buffer
+	fw := NewFrameWriter(&wire)
+	fw.SetAEAD(tx)
+	if err := fw.WriteMessage(1, []byte("sealed")); err != nil {
+		t.Fatal(err)
+	}
+	_ = fw.Flush()
+	_, rx := aeadPair(t)
+	_, _ = rx.Seal(nil, mustFrame(t, 9)) // 使接收方序号错位
+	fr := NewFrameReader(bytes.NewReader(wire.Bytes()))
+	fr.Parser().SetAEAD(rx)
+	for range 2 {
+		if _, _, err := fr.ReadMessage(); !errors.Is(err, ErrAuthFailed) {
+			t.Fatalf("err=%v, want ErrAuthFailed", err)
+		}
+	}
+}
+
+func mustFrame(t *testing.T, api uint16) []byte {
+	t.Helper()
+	enc, _ := NewEncoder()
+	f, err := enc.AppendSingle(nil, api, []byte("x"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// TestFrameIOTruncated 校验帧中途 EOF 返回 io.ErrUnexpectedEOF。
+func TestFrameIOTruncated(t *testing.T) {
+	var wire bytes.Buffer
+	fw := NewFrameWriter(&wire)
+	_ = fw.WriteMessage(1, []byte("complete"))
+	_ = fw.WriteMessage(2, []byte("truncated"))
+	_ = fw.Flush()
+	fr := NewFrameReader(bytes.NewReader(wire.Bytes()[:wire.Len()-1]))
+	if api, _, err := fr.ReadMessage(); err != nil || api != 1 {
+		t.Fatalf("first message: api %d, %v", api, err)
+	}
+	if _, _, err := fr.ReadMessage(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("err=%v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+// TestFrameWriterLimits 校验写出前按上限拒绝，且被拒绝的帧不进入缓冲。
+func TestFrameWriterLimits(t *testing.T) {
+	var wire bytes.Buffer
+	fw := NewFrameWriter(&wire)
+	fw.SetLimits(Limits{MaxMessage: 100, MaxBatchMsgs: 2, MaxFrame: 50})
+	for _, tc := range []struct {
+		name string
+		err  error
+		fn   func() error
+	}{
+		{"message", ErrMessageTooLarge, func() error { return fw.WriteMessage(1, make([]byte, 101)) }},
+		{"batch", ErrBatchTooLarge, func() error { return fw.WriteBatch(make([]BatchItem, 3)) }},
+		{"frame", ErrFrameTooLarge, func() error { return fw.WriteMessage(1, make([]byte, 80)) }},
+	} {
+		if err := tc.fn(); !errors.Is(err, tc.err) {
+			t.Errorf("%s: err=%v, want %v", tc.name, err, tc.err)
+		}
+	}
+	if fw.Buffered() != 0 {
+		t.Fatalf("%d bytes buffered after rejected writes", fw.Buffered())
+	}
+}
@@ -16,6 +16,9 @@ import (
 //   bit30: Batched (隐含 Compressed=1)
 //   bit29: Ext=1 (长头)
 //   bit28..0: Len29 (0..(1<<29)-1)
+//
+// Batched=1 且 Compressed=0 的组合表示以连接的流式上下文压缩的批量帧（见 Encoder.SetContext），
+// 仅在启用上下文接管的连接上出现。
 
 const (
 	shortHeadMaxLen = (1 << 13) - 1 // 8191
@@ -27,14 +30,50 @@ var (
 	errLengthOutOfRange = errors.New("protocol: length out of range")
 )
 
+// MaxHeaderLen 为头部的最大字节数（长头）。
+const MaxHeaderLen = 4
+
 // EncodeLenFlags 返回写入的头部字节（2 或 4 字节）和是否为长头。
 func EncodeLenFlags(length int, compressed, batched bool) (hdr []byte, isLong bool, _ error) {
-	if length < 0 || length > longHeadMaxLen {
-		return nil, false, errLengthOutOfRange
+	var h [MaxHeaderLen]byte
+	n, err := PutLenFlags(&h, length, compressed, batched)
+	if err != nil {
+		return nil, false, err
 	}
+	return append([]byte(nil), h[:n]...), n == MaxHeaderLen, nil
+}
+
+// PutLenFlags 将头部写入定长数组 h，返回写入的字节数（2 或 4），不分配内存。
+func PutLenFlags(h *[MaxHeaderLen]byte, length int, compressed, batched bool) (int, error) {
 	if batched {
 		compressed = true // 规则：Batched 隐含 Compressed
 	}
+	return putHeader(h, length, compressed, batched)
+}
+
+// AppendLenFlags 将头部追加到 dst。
+func AppendLenFlags(dst []byte, length int, compressed, batched bool) ([]byte, error) {
+	var h [MaxHeaderLen]byte
+	n, err := PutLenFlags(&h, length, compressed, batched)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, h[:n]...), nil
+}
+
+// headerLen 返回 length 对应的头部字节数。
+func headerLen(length int) int {
+	if length <= shortHeadMaxLen {
+		return 2
+	}
+	return MaxHeaderLen
+}
+
+// putHeader 按原样编码两个标志位（含 Batched=1、Compressed=0 的上下文帧）。
+func putHeader(h *[MaxHeaderLen]byte, length int, compressed, batched bool) (int, error) {
+	if length < 0 || length > longHeadMaxLen {
+		return 0, errLengthOutOfRange
+	}
 	if length <= shortHeadMaxLen {
 		// 短头：2 字节
 		var v uint16
@@ -46,9 +85,8 @@ func EncodeLenFlags(length int, compressed, batched bool) (hdr []byte, isLong bo
 		}
 		// bit13=0 表示短头
 		v |= uint16(length) & 0x1FFF
-		buf := make([]byte, 2)
-		binary.BigEndian.PutUint16(buf, v)
-		return buf, false, nil
+		binary.BigEndian.PutUint16(h[:], v)
+		return 2, nil
 	}
 	// 长头：4 字节
 	var v uint32 = 1 << 29 // Ext=1
@@ -59,9 +97,8 @@ func EncodeLenFlags(length int, compressed, batched bool) (hdr []byte, isLong bo
 		v |= 1 << 30
 	}
 	v |= uint32(length) & 0x1FFFFFFF
-	buf := make([]byte, 4)
-	binary.BigEndian.PutUint32(buf, v)
-	return buf, true, nil
+	binary.BigEndian.PutUint32(h[:], v)
+	return 4, nil
 }
 
 // DecodeLenFlags 解码头部，返回：已消费字节数、长度、compressed、batched。
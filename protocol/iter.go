@@ -0,0 +1,125 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"iter"
+)
+
+// Frame 为一个完整帧的头部信息与原始字节，不解密、不解压，可原样转发。
+// 认证帧（AEAD 模式）的 Length 含 tag，帧体为密文。
+type Frame struct {
+	// 头部字节数（2 或 4）
+	HeaderLen int
+	// 头部声明的长度（不含头部与非批量帧的 api）
+	Length     int
+	Compressed bool
+	// Batched=1 且 Compressed=0 为上下文帧（见 Encoder.SetContext）
+	Batched bool
+	// 整帧字节（含头部），引用输入缓冲
+	Raw []byte
+}
+
+// Size 返回整帧字节数。
+func (f Frame) Size() int { return len(f.Raw) }
+
+// Api 返回非批量帧的 api，批量帧没有 api 字段，返回 0。
+func (f Frame) Api() uint16 {
+	if f.Batched {
+		return 0
+	}
+	return binary.BigEndian.Uint16(f.Raw[f.HeaderLen:])
+}
+
+// Body 返回 api 之后的帧体（单帧负载或批量帧的压缩体）。
+func (f Frame) Body() []byte {
+	if f.Batched {
+		return f.Raw[f.HeaderLen:]
+	}
+	return f.Raw[f.HeaderLen+2:]
+}
+
+// PeekFrame 读取 buf 开头的一帧；帧不完整时 ok 为 false，头部非法时返回错误。
+func PeekFrame(buf []byte) (f Frame, ok bool, _ error) {
+	c, length, compressed, batched, err := DecodeLenFlags(buf)
+	if err != nil {
+		if err == errHeaderTooShort {
+			return Frame{}, false, nil
+		}
+		return Frame{}, false, err
+	}
+	n := c + length
+	if !batched {
+		n += 2
+	}
+	if len(buf) < n {
+		return Frame{}, false, nil
+	}
+	return Frame{HeaderLen: c, Length: length, Compressed: compressed, Batched: batched, Raw: buf[:n:n]}, true, nil
+}
+
+// Frames 返回逐个产出 buf 中完整帧的迭代器，遇到不完整帧时结束（已产出帧的 Size 之和即已消费字节数）；
+// 头部非法时产出该错误后结束。
+func Frames(buf []byte) iter.Seq2[Frame, error] {
+	return func(yield func(Frame, error) bool) {
+		for {
+			f, ok, err := PeekFrame(buf)
+			if err != nil {
+				yield(Frame{}, err)
+				return
+			}
+			if !ok || !yield(f, nil) {
+				return
+			}
+			buf = buf[f.Size():]
+		}
+	}
+}
+
+// MessageIter 为 Parser.Messages 的迭代状态，用法类似 bufio.Scanner：
+//
+//	it := p.Messages(buf)
+//	for api, msg := range it.All() { ... }
+//	if err := it.Err(); err != nil { ... }
+//	buf = buf[it.Consumed():]
+type MessageIter struct {
+	p        *Parser
+	buf      []byte
+	consumed int
+	err      error
+}
+
+var errStopIter = errors.New("protocol: iteration stopped")
+
+// Messages 返回逐条读取 buf 中完整帧所含消息的迭代状态，解密、解压与上限同 Parse。
+func (p *Parser) Messages(buf []byte) *MessageIter { return &MessageIter{p: p, buf: buf} }
+
+// All 逐条产出 (api, payload)，负载仅在本次迭代内有效，需保留时调用 Parser.Retain。
+// 遇到不完整帧或错误时结束；提前退出循环时所在帧视为已消费。
+func (it *MessageIter) All() iter.Seq2[uint16, []byte] {
+	return func(yield func(uint16, []byte) bool) {
+		for it.err == nil {
+			n, err := it.p.ParseFrame(it.buf[it.consumed:], func(api uint16, payload []byte) error {
+				if !yield(api, payload) {
+					return errStopIter
+				}
+				return nil
+			})
+			it.consumed += n
+			if err == errStopIter {
+				return
+			}
+			// 错误（含 n==0 时的头部错误与超限）须先记录，否则与“半帧待续”无法区分
+			it.err = err
+			if n == 0 {
+				return
+			}
+		}
+	}
+}
+
+// Consumed 返回已消费的字节数，未消费的半帧留待后续数据。
+func (it *MessageIter) Consumed() int { return it.consumed }
+
+// Err 返回迭代中遇到的第一个解析错误。
+func (it *MessageIter) Err() error { return it.err }
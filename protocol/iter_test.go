@@ -0,0 +1,184 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// stackPool 立即复用归还的缓冲，并统计未归还的个数：过早归还的缓冲会被下一次解压覆盖。
+type stackPool struct {
+	mu    sync.Mutex
+	free  [][]byte
+	inUse int
+}
+
+func (p *stackPool) Get(n int) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inUse++
+	for i := len(p.free) - 1; i >= 0; i-- {
+		if b := p.free[i]; cap(b) >= n {
+			p.free = append(p.free[:i], p.free[i+1:]...)
+			return b[:n]
+		}
+	}
+	return make([]byte, n)
+}
+
+func (p *stackPool) Put(b []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inUse--
+	p.free = append(p.free, b)
+}
+
+func iterBatch(t *testing.T, enc *Encoder, base uint16, n int) ([]byte, []BatchItem) {
+	t.Helper()
+	items := make([]BatchItem, n)
+	for i := range items {
+		items[i] = BatchItem{Api: base + uint16(i), Payload: bytes.Repeat([]byte{byte(base) + byte(i)}, 200)}
+	}
+	fr, err := enc.AppendBatch(nil, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fr, items
+}
+
+// TestMessagesEarlyBreak 校验在批内提前退出时所在帧视为已消费、缓冲随即归还且不被复用于已保留的负载，
+// 再次迭代从下一帧继续。
+func TestMessagesEarlyBreak(t *testing.T) {
+	enc, _ := NewEncoder()
+	f1, items1 := iterBatch(t, enc, 100, 10)
+	f2, items2 := iterBatch(t, enc, 200, 10)
+	buf := append(append([]byte(nil), f1...), f2...)
+	pool := &stackPool{}
+	p, _ := NewParser()
+	p.SetBufferPool(pool)
+
+	it := p.Messages(buf)
+	var kept Ref
+	n := 0
+	for api, msg := range it.All() {
+		if api != items1[n].Api || !bytes.Equal(msg, items1[n].Payload) {
+			t.Fatalf("msg %d: api %d", n, api)
+		}
+		if n == 1 {
+			kept = p.Retain()
+			break
+		}
+		n++
+	}
+	if it.Err() != nil || it.Consumed() != len(f1) {
+		t.Fatalf("after break: consumed %d/%d err %v", it.Consumed(), len(f1), it.Err())
+	}
+	if pool.inUse != 1 {
+		t.Fatalf("%d buffers in use after break, want only the retained one", pool.inUse)
+	}
+
+	// 继续迭代：第二个批量帧的解压不得覆盖仍被引用的缓冲
+	var got []uint16
+	for api, msg := range it.All() {
+		if i := len(got); !bytes.Equal(msg, items2[i].Payload) {
+			t.Fatalf("resumed msg %d mismatch", i)
+		}
+		got = append(got, api)
+	}
+	if len(got) != len(items2) || it.Err() != nil || it.Consumed() != len(buf) {
+		t.Fatalf("resumed: %d msgs, consumed %d/%d, err %v", len(got), it.Consumed(), len(buf), it.Err())
+	}
+	if !bytes.Equal(kept.Bytes(), items1[1].Payload) {
+		t.Fatal("retained payload overwritten after break")
+	}
+	kept.Release()
+	if pool.inUse != 0 {
+		t.Fatalf("%d buffers leaked", pool.inUse)
+	}
+}
+
+// TestMessagesErrors 校验错误前的消息照常产出、Err 返回该错误且 Consumed 停在出错帧之前（超长帧）
+// 或之后（帧体错误），半帧不算错误。
+func TestMessagesErrors(t *testing.T) {
+	enc, _ := NewEncoder()
+	good, _ := enc.AppendSingle(nil, 1, []byte("ok"), 0)
+	batch, _ := iterBatch(t, enc, 10, 5)
+	corrupt, _ := enc.AppendFrame(nil, 2, []byte("not a compressed block"), true, false)
+	for _, tc := range []struct {
+		name     string
+		buf      []byte
+		limits   Limits
+		msgs     int
+		consumed int
+		err      error
+	}{
+		{"incomplete", append(bytes.Clone(good), good[:len(good)-1]...), DefaultLimits(), 1, len(good), nil},
+		{"frame limit", append(bytes.Clone(good), batch...), Limits{MaxFrame: len(batch) - 3}, 1, len(good), ErrFrameTooLarge},
+		{"batch limit", append(bytes.Clone(good), batch...), Limits{MaxBatchMsgs: 4}, 1, len(good) + len(batch), ErrBatchTooLarge},
+		{"corrupt", append(bytes.Clone(good), corrupt...), DefaultLimits(), 1, len(good) + len(corrupt), nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, _ := NewParser()
+			p.SetLimits(tc.limits)
+			it := p.Messages(tc.buf)
+			n := 0
+			for range it.All() {
+				n++
+			}
+			if n != tc.msgs || it.Consumed() != tc.consumed {
+				t.Fatalf("%d msgs, consumed %d; want %d, %d", n, it.Consumed(), tc.msgs, tc.consumed)
+			}
+			if tc.name == "corrupt" {
+				if it.Err() == nil {
+					t.Fatal("corrupt body: Err() = nil")
+				}
+			} else if !errors.Is(it.Err(), tc.err) {
+				t.Fatalf("Err() = %v, want %v", it.Err(), tc.err)
+			}
+			// 出错后不再产出
+			for range it.All() {
+				if it.Err() != nil {
+					t.Fatal("yielded after an error")
+				}
+			}
+		})
+	}
+}
+
+// TestFramesIter 校验 Frames 的提前退出与末尾半帧。
+func TestFramesIter(t *testing.T) {
+	enc, _ := NewEncoder()
+	var buf []byte
+	for i := range 3 {
+		buf, _ = enc.AppendSingle(buf, uint16(i), []byte("frame"), 0)
+	}
+	n, size := 0, 0
+	for f, err := range Frames(buf) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Api() != uint16(n) {
+			t.Fatalf("frame %d: api %d", n, f.Api())
+		}
+		n++
+		size += f.Size()
+		if n == 2 {
+			break
+		}
+	}
+	if n != 2 || size != 2*len(buf)/3 {
+		t.Fatalf("break after 2 frames: n=%d size=%d", n, size)
+	}
+	// 末尾半帧不产出
+	n = 0
+	for _, err := range Frames(buf[:len(buf)-1]) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("%d frames before an incomplete tail, want 2", n)
+	}
+}
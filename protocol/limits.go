@@ -0,0 +1,77 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Limits 为 Parser 的资源上限，防御超大帧与解压炸弹；零值字段表示不限。
+type Limits struct {
+	// 帧长度上限：头部声明的长度（不含头部），只读到头部即可判定
+	MaxFrame int
+	// 单帧解压后的字节数上限（单帧负载或批前镜像），经 zstd 解码器内存上限等在解压过程中执行
+	MaxDecompressed int
+	// 单个批量帧内的消息数上限
+	MaxBatchMsgs int
+	// 单条消息负载（解压后）的长度上限
+	MaxMessage int
+}
+
+// DefaultLimits 返回 NewParser 及服务端与客户端缺省的解析上限；帧长度不设上限（由各自的接收缓冲约束）。
+func DefaultLimits() Limits {
+	return Limits{MaxDecompressed: 32 << 20, MaxBatchMsgs: 64 << 10, MaxMessage: 16 << 20}
+}
+
+var (
+	ErrFrameTooLarge        = errors.New("protocol: frame exceeds size limit")
+	ErrDecompressedTooLarge = errors.New("protocol: decompressed size exceeds limit")
+	ErrBatchTooLarge        = errors.New("protocol: too many messages in batch")
+	ErrMessageTooLarge      = errors.New("protocol: message exceeds size limit")
+	// ErrMalformedBatch 表示批前镜像的消息数或长度与实际内容不符。
+	ErrMalformedBatch = errors.New("protocol: malformed batch")
+	// ErrMalformedFrame 表示帧体不足以容纳 api（认证帧解密后的明文过短）。
+	ErrMalformedFrame = errors.New("protocol: malformed frame")
+)
+
+// SetLimits 设置其后解析所用的上限；违反上限时 Parse/ParseFrame 返回对应的错误，连接应随之关闭。
+func (p *Parser) SetLimits(l Limits) { p.lim = l }
+
+// decompress 按 MaxDecompressed 将帧体解压到池化缓冲。
+func (p *Parser) decompress(src []byte) (*buffer, error) {
+	b := newBuffer(p.bufferPool(), p.hint(p.decodedSize(src)))
+	out, err := p.decompressTo(b.b, src)
+	if err != nil {
+		b.release()
+		return nil, err
+	}
+	b.set(out)
+	return b, nil
+}
+
+func (p *Parser) decompressTo(dst, src []byte) ([]byte, error) {
+	max := p.lim.MaxDecompressed
+	if max <= 0 {
+		return p.comp.Decompress(dst, src)
+	}
+	if ld, ok := p.comp.(LimitedDecompressor); ok {
+		return ld.DecompressLimit(dst, src, max)
+	}
+	out, err := p.comp.Decompress(dst, src)
+	if err == nil && len(out) > max {
+		return nil, ErrDecompressedTooLarge
+	}
+	return out, err
+}
+
+// decodeContext 将上下文帧体解码到池化缓冲。
+func (p *Parser) decodeContext(body []byte) (*buffer, error) {
+	n, _ := binary.Uvarint(body)
+	b := newBuffer(p.bufferPool(), p.hint(int(min(n, maxHint))))
+	out, err := p.ctx.decode(b.b, body, p.lim.MaxDecompressed)
+	if err != nil {
+		b.release()
+		return nil, err
+	}
+	b.set(out)
+	return b, nil
+}
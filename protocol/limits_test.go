@@ -0,0 +1,133 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// parseErr 解析 buf 并返回错误，期间收到任何消息即失败。
+func parseErr(t *testing.T, p *Parser, buf []byte) (int, error) {
+	t.Helper()
+	return p.Parse(buf, func(api uint16, b []byte) error {
+		t.Errorf("unexpected message api=%d len=%d", api, len(b))
+		return nil
+	})
+}
+
+// TestLimitFrameHeader 校验只读到头部即可拒绝超长帧，无须缓冲帧体。
+func TestLimitFrameHeader(t *testing.T) {
+	p, _ := NewParser()
+	p.SetLimits(Limits{MaxFrame: 64 << 10})
+	hdr, err := AppendLenFlags(nil, 64<<10+1, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := parseErr(t, p, hdr); !errors.Is(err, ErrFrameTooLarge) || n != 0 {
+		t.Fatalf("n=%d err=%v, want ErrFrameTooLarge", n, err)
+	}
+	hdr, _ = AppendLenFlags(nil, 64<<10, false, false)
+	if n, err := parseErr(t, p, hdr); err != nil || n != 0 {
+		t.Fatalf("frame at limit: n=%d err=%v, want incomplete", n, err)
+	}
+}
+
+// TestLimitDecompressed 校验各类算法的单帧与批量帧解压结果超过 MaxDecompressed 时返回错误。
+func TestLimitDecompressed(t *testing.T) {
+	zeros := make([]byte, 4<<20)
+	for _, name := range []string{"zstd", "s2", "snappy", "deflate"} {
+		comp, err := LookupCompressor(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc, _ := NewEncoder()
+		enc.SetCompressor(comp)
+		single, err := enc.AppendSingle(nil, 1, zeros, FlagCompress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch, err := enc.AppendBatch(nil, []BatchItem{{Api: 1, Payload: zeros[:1<<19]}, {Api: 2, Payload: zeros[:1<<19]}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fr := range []struct {
+			kind string
+			b    []byte
+		}{{"single", single}, {"batch", batch}} {
+			p, _ := NewParser()
+			p.SetCompressor(comp)
+			p.SetLimits(Limits{MaxDecompressed: 1 << 19})
+			if n, err := parseErr(t, p, fr.b); !errors.Is(err, ErrDecompressedTooLarge) || n != len(fr.b) {
+				t.Errorf("%s %s: n=%d/%d err=%v, want ErrDecompressedTooLarge", name, fr.kind, n, len(fr.b), err)
+			}
+		}
+	}
+}
+
+// TestLimitForgedDecodedLen 校验块格式声明的巨大解压长度在分配前即被 NewParser 的缺省上限拒绝。
+func TestLimitForgedDecodedLen(t *testing.T) {
+	comp, _ := LookupCompressor("s2")
+	p, _ := NewParser()
+	p.SetCompressor(comp)
+	enc, _ := NewEncoder()
+	// uvarint 声明约 4GiB
+	fr, _ := enc.AppendFrame(nil, 1, []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 0x00}, true, false)
+	if _, err := parseErr(t, p, fr); !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Fatalf("err=%v, want ErrDecompressedTooLarge", err)
+	}
+}
+
+// TestLimitBatchMsgs 校验批内消息数超过 MaxBatchMsgs 时整帧被拒绝、不交付任何消息。
+func TestLimitBatchMsgs(t *testing.T) {
+	enc, _ := NewEncoder()
+	items := make([]BatchItem, 11)
+	fr, err := enc.AppendBatch(nil, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := NewParser()
+	p.SetLimits(Limits{MaxBatchMsgs: 10})
+	if _, err := parseErr(t, p, fr); !errors.Is(err, ErrBatchTooLarge) {
+		t.Fatalf("err=%v, want ErrBatchTooLarge", err)
+	}
+	// 缺省上限
+	items = make([]BatchItem, DefaultLimits().MaxBatchMsgs+1)
+	if fr, err = enc.AppendBatch(nil, items); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = NewParser()
+	if _, err := parseErr(t, p, fr); !errors.Is(err, ErrBatchTooLarge) {
+		t.Fatalf("default limits: err=%v, want ErrBatchTooLarge", err)
+	}
+}
+
+// TestLimitForgedBatchCount 校验声明条数远超内容的批前镜像以 ErrMalformedBatch 拒绝，不按声明分配。
+func TestLimitForgedBatchCount(t *testing.T) {
+	comp := defaultCompressor()
+	body, err := comp.Compress(nil, binary.AppendUvarint(nil, 1<<40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := NewEncoder()
+	fr, _ := enc.AppendFrame(nil, 0, body, true, true)
+	p, _ := NewParser()
+	p.SetLimits(Limits{})
+	if _, err := parseErr(t, p, fr); !errors.Is(err, ErrMalformedBatch) {
+		t.Fatalf("err=%v, want ErrMalformedBatch", err)
+	}
+}
+
+// TestLimitMessage 校验单帧与批内消息超过 MaxMessage 时返回 ErrMessageTooLarge。
+func TestLimitMessage(t *testing.T) {
+	enc, _ := NewEncoder()
+	big := make([]byte, 1025)
+	single, _ := enc.AppendSingle(nil, 1, big, 0)
+	batch, _ := enc.AppendBatch(nil, []BatchItem{{Api: 1, Payload: big}})
+	for _, fr := range [][]byte{single, batch} {
+		p, _ := NewParser()
+		p.SetLimits(Limits{MaxMessage: 1024})
+		if _, err := parseErr(t, p, fr); !errors.Is(err, ErrMessageTooLarge) {
+			t.Errorf("err=%v, want ErrMessageTooLarge", err)
+		}
+	}
+}
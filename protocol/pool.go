@@ -1,23 +1,54 @@
 package protocol
 
 import (
+	"errors"
 	"sync"
 
 	"github.com/klauspost/compress/zstd"
 )
 
-var (
-	encoderPool = sync.Pool{New: func() any {
-		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
-		return enc
-	}}
-	decoderPool = sync.Pool{New: func() any {
-		dec, _ := zstd.NewReader(nil)
+// zstdDecoders 按解压上限（WithDecoderMaxMemory）分别池化解码器；opts 为共同的解码选项（如字典）。
+// 上限通常只有少数几种（每个服务端/客户端配置一种），0 表示不限。
+type zstdDecoders struct {
+	opts  []zstd.DOption
+	pools sync.Map // int -> *sync.Pool
+}
+
+func (z *zstdDecoders) pool(limit int) *sync.Pool {
+	if p, ok := z.pools.Load(limit); ok {
+		return p.(*sync.Pool)
+	}
+	opts := z.opts
+	if limit > 0 {
+		opts = append(opts[:len(opts):len(opts)], zstd.WithDecoderMaxMemory(uint64(limit)))
+	}
+	p, _ := z.pools.LoadOrStore(limit, &sync.Pool{New: func() any {
+		dec, _ := zstd.NewReader(nil, opts...)
 		return dec
-	}}
-)
+	}})
+	return p.(*sync.Pool)
+}
+
+// decodeAll 以上限为 limit 的解码器解压 src 并追加到 dst，超出上限时返回 ErrDecompressedTooLarge。
+func (z *zstdDecoders) decodeAll(dst, src []byte, limit int) ([]byte, error) {
+	p := z.pool(limit)
+	dec := p.Get().(*zstd.Decoder)
+	defer p.Put(dec)
+	out, err := dec.DecodeAll(src, dst)
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return nil, ErrDecompressedTooLarge
+	}
+	return out, err
+}
+
+// zstdContentSize 返回 zstd 帧头声明的内容长度，未声明时返回 0。
+func zstdContentSize(src []byte) int {
+	var h zstd.Header
+	if h.Decode(src) != nil || !h.HasFCS || h.FrameContentSize > maxHint {
+		return 0
+	}
+	return int(h.FrameContentSize)
+}
 
-func getEncoder() *zstd.Encoder  { return encoderPool.Get().(*zstd.Encoder) }
-func putEncoder(e *zstd.Encoder) { encoderPool.Put(e) }
-func getDecoder() *zstd.Decoder  { return decoderPool.Get().(*zstd.Decoder) }
-func putDecoder(d *zstd.Decoder) { decoderPool.Put(d) }
+// zstd 解码器与编码级别无关，全部内置 zstd 压缩算法共享。
+var plainDecoders zstdDecoders
@@ -0,0 +1,192 @@
+package protocol
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// 类型化消息：Codec 在负载与 Go 类型之间编解码，Registry 登记 api 与类型的一一对应，
+// Dispatcher 按 api 解码并交给以类型登记的处理函数，取代手写的 switch 与 Unmarshal。
+
+// Codec 在消息负载与 T 之间编解码。Marshal 将编码结果追加到 dst；
+// Unmarshal 的 data 仅在调用期间有效，需要保留的部分须拷贝。
+type Codec[T any] interface {
+	Marshal(dst []byte, v *T) ([]byte, error)
+	Unmarshal(data []byte, v *T) error
+}
+
+// BinaryMessage 为实现 encoding.BinaryMarshaler/BinaryUnmarshaler 的 *T。
+type BinaryMessage[T any] interface {
+	*T
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+type binaryCodec[T any, PT BinaryMessage[T]] struct{}
+
+// Binary 返回经 T 的 MarshalBinary/UnmarshalBinary 编解码的 Codec，如 Binary[LoginReq]()。
+func Binary[T any, PT BinaryMessage[T]]() Codec[T] { return binaryCodec[T, PT]{} }
+
+func (binaryCodec[T, PT]) Marshal(dst []byte, v *T) ([]byte, error) {
+	b, err := PT(v).MarshalBinary()
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, b...), nil
+}
+
+func (binaryCodec[T, PT]) Unmarshal(data []byte, v *T) error { return PT(v).UnmarshalBinary(data) }
+
+type jsonCodec[T any] struct{}
+
+// JSON 返回经 encoding/json 编解码的 Codec。
+func JSON[T any]() Codec[T] { return jsonCodec[T]{} }
+
+func (jsonCodec[T]) Marshal(dst []byte, v *T) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, b...), nil
+}
+
+func (jsonCodec[T]) Unmarshal(data []byte, v *T) error { return json.Unmarshal(data, v) }
+
+var (
+	// ErrUnknownApi 表示 api 未登记类型或未登记处理函数。
+	ErrUnknownApi = errors.New("protocol: unknown api")
+	// ErrUnregisteredType 表示类型未在 Registry 中登记。
+	ErrUnregisteredType = errors.New("protocol: unregistered message type")
+	// ErrDuplicateApi 表示 api 或类型已登记。
+	ErrDuplicateApi = errors.New("protocol: duplicate api registration")
+	// ErrReservedApi 表示 api 位于保留的控制帧段（见 IsControl），不可登记或发送业务消息。
+	ErrReservedApi = errors.New("protocol: api reserved for control frames")
+)
+
+type typeEntry struct {
+	typ    reflect.Type
+	decode func(data []byte) (any, error)
+	encode func(dst []byte, v any) ([]byte, error)
+}
+
+// Registry 登记 api 与消息类型的一一对应及其 Codec。登记须在开始收发之前完成，
+// 之后可并发读取。
+type Registry struct {
+	byApi  map[uint16]*typeEntry
+	byType map[reflect.Type]uint16
+}
+
+func NewRegistry() *Registry {
+	return &Registry{byApi: make(map[uint16]*typeEntry), byType: make(map[reflect.Type]uint16)}
+}
+
+// Register 将 api 登记为 T，以 c 编解码；控制帧段的 api 不可登记。
+func Register[T any](r *Registry, api uint16, c Codec[T]) error {
+	if IsControl(api) {
+		return fmt.Errorf("%w: %#x", ErrReservedApi, api)
+	}
+	typ := reflect.TypeFor[T]()
+	if _, ok := r.byApi[api]; ok {
+		return fmt.Errorf("%w: api %d", ErrDuplicateApi, api)
+	}
+	if _, ok := r.byType[typ]; ok {
+		return fmt.Errorf("%w: type %v", ErrDuplicateApi, typ)
+	}
+	r.byApi[api] = &typeEntry{
+		typ: typ,
+		decode: func(data []byte) (any, error) {
+			v := new(T)
+			if err := c.Unmarshal(data, v); err != nil {
+				return nil, err
+			}
+			return v, nil
+		},
+		encode: func(dst []byte, v any) ([]byte, error) { return c.Marshal(dst, v.(*T)) },
+	}
+	r.byType[typ] = api
+	return nil
+}
+
+// ApiOf 返回 T 登记的 api。
+func ApiOf[T any](r *Registry) (uint16, bool) {
+	api, ok := r.byType[reflect.TypeFor[T]()]
+	return api, ok
+}
+
+// TypeOf 返回 api 登记的类型。
+func (r *Registry) TypeOf(api uint16) (reflect.Type, bool) {
+	e, ok := r.byApi[api]
+	if !ok {
+		return nil, false
+	}
+	return e.typ, true
+}
+
+// Decode 将 api 的负载解码为新分配的 *T（以 any 返回），api 未登记时返回 ErrUnknownApi。
+func (r *Registry) Decode(api uint16, data []byte) (any, error) {
+	e, ok := r.byApi[api]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownApi, api)
+	}
+	v, err := e.decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("protocol: decode api %d as %v: %w", api, e.typ, err)
+	}
+	return v, nil
+}
+
+// Encode 将 v（须为已登记类型的指针 *T）编码后追加到 dst，返回其 api。
+func (r *Registry) Encode(dst []byte, v any) (uint16, []byte, error) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Pointer {
+		return 0, dst, fmt.Errorf("%w: %T", ErrUnregisteredType, v)
+	}
+	api, ok := r.byType[t.Elem()]
+	if !ok {
+		return 0, dst, fmt.Errorf("%w: %T", ErrUnregisteredType, v)
+	}
+	out, err := r.byApi[api].encode(dst, v)
+	return api, out, err
+}
+
+// Dispatcher 将消息按 api 解码为 Registry 中登记的类型，交给以 Handle 登记的处理函数；
+// S 为会话类型（服务端连接或客户端）。处理函数须在开始分发之前登记完毕。
+type Dispatcher[S any] struct {
+	reg      *Registry
+	handlers map[uint16]func(s S, v any)
+}
+
+func NewDispatcher[S any](reg *Registry) *Dispatcher[S] {
+	return &Dispatcher[S]{reg: reg, handlers: make(map[uint16]func(s S, v any))}
+}
+
+// Registry 返回分发所用的登记表。
+func (d *Dispatcher[S]) Registry() *Registry { return d.reg }
+
+// Handle 为 T 登记处理函数，T 须已在 Registry 中登记；重复登记时覆盖。
+func Handle[S, T any](d *Dispatcher[S], fn func(s S, m *T)) error {
+	api, ok := ApiOf[T](d.reg)
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrUnregisteredType, reflect.TypeFor[T]())
+	}
+	d.handlers[api] = func(s S, v any) { fn(s, v.(*T)) }
+	return nil
+}
+
+// Dispatch 解码 msg 并同步调用 api 的处理函数；api 未登记类型或处理函数时返回 ErrUnknownApi，
+// 解码失败时返回包装后的错误，均不调用处理函数。
+func (d *Dispatcher[S]) Dispatch(s S, api uint16, msg []byte) error {
+	h, ok := d.handlers[api]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownApi, api)
+	}
+	v, err := d.reg.Decode(api, msg)
+	if err != nil {
+		return err
+	}
+	h(s, v)
+	return nil
+}
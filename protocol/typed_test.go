@@ -0,0 +1,136 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var errShortPoint = errors.New("point: short data")
+
+type point struct{ X, Y int32 }
+
+func (p *point) MarshalBinary() ([]byte, error) {
+	return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, uint32(p.X)), uint32(p.Y)), nil
+}
+
+func (p *point) UnmarshalBinary(b []byte) error {
+	if len(b) != 8 {
+		return errShortPoint
+	}
+	p.X, p.Y = int32(binary.BigEndian.Uint32(b)), int32(binary.BigEndian.Uint32(b[4:]))
+	return nil
+}
+
+type chat struct {
+	Text string `json:"text"`
+}
+
+func typedRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r := NewRegistry()
+	if err := Register(r, 1, Binary[point]()); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(r, 2, JSON[chat]()); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRegister(t *testing.T) {
+	r := typedRegistry(t)
+	for _, tc := range []struct {
+		name string
+		err  error
+		fn   func() error
+	}{
+		{"reserved", ErrReservedApi, func() error { return Register(r, ApiPing, JSON[struct{}]()) }},
+		{"reserved lowest", ErrReservedApi, func() error { return Register(r, 0xFF00, JSON[struct{}]()) }},
+		{"duplicate api", ErrDuplicateApi, func() error { return Register(r, 1, JSON[struct{}]()) }},
+		{"duplicate type", ErrDuplicateApi, func() error { return Register(r, 3, JSON[chat]()) }},
+	} {
+		if err := tc.fn(); !errors.Is(err, tc.err) {
+			t.Errorf("%s: err=%v, want %v", tc.name, err, tc.err)
+		}
+	}
+	if api, ok := ApiOf[chat](r); !ok || api != 2 {
+		t.Fatalf("ApiOf[chat] = %d, %v", api, ok)
+	}
+	if _, ok := ApiOf[struct{}](r); ok {
+		t.Fatal("ApiOf reports a type rejected by Register")
+	}
+	if typ, ok := r.TypeOf(1); !ok || typ != reflect.TypeFor[point]() {
+		t.Fatalf("TypeOf(1) = %v, %v", typ, ok)
+	}
+}
+
+// TestRegistryCodec 校验 Encode/Decode 经两种 Codec 往返，以及未登记类型、未知 api 与解码失败的错误。
+func TestRegistryCodec(t *testing.T) {
+	r := typedRegistry(t)
+	for _, v := range []any{&point{X: -3, Y: 7}, &chat{Text: "hi"}} {
+		api, b, err := r.Encode([]byte("prefix"), v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b[:6]) != "prefix" {
+			t.Fatalf("%T: Encode did not append to dst", v)
+		}
+		got, err := r.Decode(api, b[6:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Fatalf("api %d: decoded %+v, want %+v", api, got, v)
+		}
+	}
+	for _, v := range []any{nil, point{}, &struct{}{}} {
+		if _, _, err := r.Encode(nil, v); !errors.Is(err, ErrUnregisteredType) {
+			t.Errorf("Encode(%T): err=%v, want ErrUnregisteredType", v, err)
+		}
+	}
+	if _, err := r.Decode(9, nil); !errors.Is(err, ErrUnknownApi) {
+		t.Errorf("Decode unknown api: err=%v", err)
+	}
+	if _, err := r.Decode(1, []byte{1}); !errors.Is(err, errShortPoint) {
+		t.Errorf("Decode short point: err=%v, want the codec error wrapped", err)
+	}
+}
+
+// TestDispatcher 校验 Dispatch 按 api 解码后调用对应处理函数，未登记或解码失败时返回错误且不调用。
+func TestDispatcher(t *testing.T) {
+	r := typedRegistry(t)
+	d := NewDispatcher[string](r)
+	if err := Handle(d, func(s string, m *struct{}) {}); !errors.Is(err, ErrUnregisteredType) {
+		t.Fatalf("Handle unregistered type: err=%v", err)
+	}
+	var got []string
+	if err := Handle(d, func(s string, m *point) { t.Error("replaced handler called") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := Handle(d, func(s string, m *point) { got = append(got, s) }); err != nil {
+		t.Fatal(err)
+	}
+	_, b, _ := r.Encode(nil, &point{X: 1, Y: 2})
+	if err := d.Dispatch("a", 1, b); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		api  uint16
+		msg  []byte
+		err  error
+	}{
+		{"no handler", 2, []byte(`{"text":"x"}`), ErrUnknownApi},
+		{"unregistered api", 9, nil, ErrUnknownApi},
+		{"decode failure", 1, b[:3], errShortPoint},
+	} {
+		if err := d.Dispatch("b", tc.api, tc.msg); !errors.Is(err, tc.err) {
+			t.Errorf("%s: err=%v, want %v", tc.name, err, tc.err)
+		}
+	}
+	if len(got) != 1 || got[0] != "a" {
+		t.Fatalf("handler calls: %v", got)
+	}
+}
@@ -5,6 +5,7 @@ package server
 import (
 	"time"
 
+	"github.com/legamerdc/gio/internal/netutil"
 	"golang.org/x/sys/unix"
 )
 
@@ -14,7 +15,7 @@ func startAcceptorShard[C Cipher](s *Server[C], idx int) {
 	// 简单轮询接受，增强兼容性
 	t := time.NewTicker(10 * time.Millisecond)
 	defer t.Stop()
-	for {
+	for !s.stopping.Load() {
 		select {
 		case <-t.C:
 			acceptAllShard(s, idx)
@@ -25,6 +26,9 @@ func startAcceptorShard[C Cipher](s *Server[C], idx int) {
 }
 
 func acceptAllShard[C Cipher](s *Server[C], idx int) {
+	if s.stopping.Load() {
+		return
+	}
 	lfd := s.lfds[idx]
 	p := s.pls[idx]
 	for {
@@ -36,9 +40,11 @@ func acceptAllShard[C Cipher](s *Server[C], idx int) {
 			return
 		}
 		_ = unix.SetNonblock(fd, true)
+		_ = netutil.SetNoDelay(fd, true)
 		_ = p.Register(fd, true, false)
 		ic := newConnectionShard[C](fd, s, idx)
 		s.conns.Store(fd, ic)
-		go s.h.OnOpen(&ic.api)
+		s.nconns.Add(1)
+		ic.open()
 	}
 }
@@ -3,6 +3,7 @@
 package server
 
 import (
+	"github.com/legamerdc/gio/internal/netutil"
 	"golang.org/x/sys/unix"
 )
 
@@ -12,6 +13,9 @@ func startAcceptorShard[C Cipher](s *Server[C], idx int) { /* 预留，linux 下
 }
 
 func acceptAllShard[C Cipher](s *Server[C], idx int) {
+	if s.stopping.Load() {
+		return
+	}
 	lfd := s.lfds[idx]
 	p := s.pls[idx]
 	for {
@@ -22,9 +26,11 @@ func acceptAllShard[C Cipher](s *Server[C], idx int) {
 			}
 			return
 		}
+		_ = netutil.SetNoDelay(fd, true)
 		_ = p.Register(fd, true, false)
 		ic := newConnectionShard[C](fd, s, idx)
 		s.conns.Store(fd, ic)
-		go s.h.OnOpen(&ic.api)
+		s.nconns.Add(1)
+		ic.open()
 	}
 }
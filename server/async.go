@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+
+	"github.com/legamerdc/gio/protocol"
+)
+
+// 异步分流状态：Idle → AsyncBusy → Draining → Idle
+const (
+	asyncIdle int32 = iota
+	asyncBusy
+	asyncDraining
+)
+
+// rxMsg 为积压在 rxBacklog 中的消息，持有负载的引用（池化解压缓冲或 per-poller 字节池中的拷贝）。
+type rxMsg struct {
+	api uint16
+	ref protocol.Ref
+}
+
+// goAsync 提交异步任务；同一连接的任务按提交顺序串行执行。
+// 全部任务完成后经 eventfd 回投到所属 poller，若连接处于 asyncBusy 则由其清除并排空积压。
+func (c *connection[C]) goAsync(task func(ctx context.Context) error) {
+	c.taskMu.Lock()
+	c.tasks = append(c.tasks, task)
+	start := !c.taskRunning
+	c.taskRunning = true
+	c.taskMu.Unlock()
+	if start {
+		go c.runTasks()
+	}
+}
+
+func (c *connection[C]) runTasks() {
+	for {
+		c.taskMu.Lock()
+		if len(c.tasks) == 0 {
+			c.taskRunning = false
+			c.taskMu.Unlock()
+			break
+		}
+		task := c.tasks[0]
+		c.tasks[0] = nil
+		c.tasks = c.tasks[1:]
+		c.taskMu.Unlock()
+		if err := task(c.ctx); err != nil {
+			c.taskMu.Lock()
+			c.tasks = nil
+			c.taskRunning = false
+			c.taskMu.Unlock()
+			c.sh.post(func() { c.onClose(err) })
+			return
+		}
+	}
+	c.sh.post(c.onAsyncDone)
+}
+
+// enterBusy 在 OnMessage 返回 async=true 后调用：仅当仍有未完成的任务时进入 asyncBusy。
+// 判定与状态切换都在 taskMu 内，任务随后完成时回投的 onAsyncDone 必然看到 asyncBusy；
+// 没有未完成任务时不会再有完成事件，保持原状态，避免连接永久积压。
+func (c *connection[C]) enterBusy() {
+	c.taskMu.Lock()
+	if c.taskRunning {
+		c.async.Store(asyncBusy)
+	}
+	c.taskMu.Unlock()
+}
+
+// onAsyncDone 在 poller goroutine 中处理任务完成事件。
+func (c *connection[C]) onAsyncDone() {
+	if c.closed {
+		return
+	}
+	c.taskMu.Lock()
+	running := c.taskRunning
+	c.taskMu.Unlock()
+	if running || !c.async.CompareAndSwap(asyncBusy, asyncDraining) {
+		return
+	}
+	c.drain()
+}
+
+// drain 按公平策略排空 rxBacklog：每轮最多 AsyncDrainBatch 条，未清空则重新排队。
+func (c *connection[C]) drain() {
+	if c.closed || c.closing || c.async.Load() != asyncDraining {
+		return
+	}
+	for k := 0; k < c.srv.cfg.AsyncDrainBatch && c.blHead < len(c.backlog); k++ {
+		m := c.backlog[c.blHead]
+		c.backlog[c.blHead] = rxMsg{}
+		c.blHead++
+		c.rxRef, c.rxDrain = m.ref, true
+		c.deliver(m.api, m.ref.Bytes())
+		c.rxRef, c.rxDrain = protocol.Ref{}, false
+		m.ref.Release()
+		if c.closed || c.closing || c.async.Load() != asyncDraining {
+			// 业务再次进入异步分流或连接已关闭
+			return
+		}
+	}
+	if c.blHead < len(c.backlog) {
+		c.sh.post(c.drain)
+		return
+	}
+	c.backlog = c.backlog[:0]
+	c.blHead = 0
+	if !c.async.CompareAndSwap(asyncDraining, asyncIdle) {
+		return
+	}
+	if c.readPaused() {
+		c.resumeRead()
+	}
+}
+
+// pushBacklog 在解析回调中保留负载并积压：批量帧与压缩帧的消息只引用池化解压缓冲，
+// 负载指向 rx 环的未压缩单帧拷贝到 per-poller 字节池。
+func (c *connection[C]) pushBacklog(api uint16) {
+	c.backlog = append(c.backlog, rxMsg{api: api, ref: c.prs.Retain()})
+}
+
+// retain 实现 Conn.Retain：积压消息复用其已持有的引用，否则由解析器保留当前消息。
+func (c *connection[C]) retain() protocol.Ref {
+	if c.rxDrain {
+		return c.rxRef.Retain()
+	}
+	return c.prs.Retain()
+}
+
+func (c *connection[C]) releaseBacklog() {
+	for i := c.blHead; i < len(c.backlog); i++ {
+		c.backlog[i].ref.Release()
+	}
+	c.backlog = nil
+	c.blHead = 0
+}
+
+func (c *connection[C]) readPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rxPaused
+}
+
+// pauseRead 关闭读事件（PauseRead 策略）。
+func (c *connection[C]) pauseRead() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rxPaused {
+		return
+	}
+	c.rxPaused = true
+	if c.pl != nil {
+		_ = c.pl.Mod(c.fd, false, c.outOn)
+	}
+}
+
+// resumeRead 先解析环内留存的帧，再重新打开读事件并读取暂停期间到达的数据。
+func (c *connection[C]) resumeRead() {
+	c.mu.Lock()
+	c.rxPaused = false
+	c.mu.Unlock()
+	if err := c.parseRx(); err != nil {
+		c.onClose(err)
+		return
+	}
+	if c.readPaused() {
+		return
+	}
+	c.mu.Lock()
+	if c.pl != nil {
+		_ = c.pl.Mod(c.fd, true, c.outOn)
+	}
+	c.mu.Unlock()
+	c.onReadable()
+}
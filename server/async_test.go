@@ -0,0 +1,176 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/legamerdc/gio/protocol"
+	"github.com/legamerdc/gio/server"
+)
+
+// 按 api 区分的异步分流方式
+const (
+	apiPlain   uint16 = iota // 同步处理
+	apiBarrier               // c.Go 提交阻塞在 gate 上的任务并返回 async=true
+	apiOffload               // c.Go 提交阻塞任务但返回 false，后续消息不等待
+	apiNoTask                // 返回 async=true 但不提交任务
+	apiDone                  // 提交立即完成的任务，待其完成后才返回 async=true
+	apiFail                  // 提交在 gate 打开后返回错误的任务
+)
+
+var errTask = errors.New("task failed")
+
+// asyncHandler 按 api 执行不同的分流方式，收到的消息依次送入 recv。
+type asyncHandler struct {
+	recv   chan rxMsg
+	gate   chan struct{}
+	closed chan error
+}
+
+func (asyncHandler) OnOpen(c *server.Conn[nopCipher]) {}
+
+func (h asyncHandler) OnMessage(c *server.Conn[nopCipher], api uint16, msg []byte) bool {
+	h.recv <- rxMsg{api, append([]byte(nil), msg...)}
+	wait := func(ctx context.Context) error {
+		select {
+		case <-h.gate:
+		case <-ctx.Done():
+		}
+		return nil
+	}
+	switch api {
+	case apiBarrier:
+		c.Go(wait)
+		return true
+	case apiOffload:
+		c.Go(wait)
+		return false
+	case apiNoTask:
+		return true
+	case apiDone:
+		done := make(chan struct{})
+		c.Go(func(context.Context) error { close(done); return nil })
+		<-done
+		time.Sleep(10 * time.Millisecond)
+		return true
+	case apiFail:
+		c.Go(func(context.Context) error { <-h.gate; return errTask })
+		return true
+	}
+	return false
+}
+
+func (h asyncHandler) OnClose(c *server.Conn[nopCipher], err error) { h.closed <- err }
+
+func startAsync(t *testing.T, strategy server.AsyncStrategy) (asyncHandler, func(api uint16, msg string)) {
+	t.Helper()
+	addr := freeAddr(t)
+	h := asyncHandler{recv: make(chan rxMsg, 64), gate: make(chan struct{}), closed: make(chan error, 1)}
+	srv, err := server.Start[nopCipher](server.Config[nopCipher]{
+		ListenNetwork:   "tcp",
+		ListenAddress:   addr,
+		AsyncStrategy:   strategy,
+		AsyncDrainBatch: 2,
+	}, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Stop(context.Background()) })
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	enc, _ := protocol.NewEncoder()
+	return h, func(api uint16, msg string) {
+		f, _ := enc.EncodeSingle(api, []byte(msg), false)
+		if _, err := nc.Write(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func msgs(api uint16, ss ...string) []rxMsg {
+	out := make([]rxMsg, len(ss))
+	for i, s := range ss {
+		out[i] = rxMsg{api, []byte(s)}
+	}
+	return out
+}
+
+// TestAsyncBarrier 校验返回 async=true 后，后续消息在任务完成前积压（或暂停读取），完成后按序交付。
+func TestAsyncBarrier(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		strategy server.AsyncStrategy
+	}{{"CopyToPool", server.CopyToPool}, {"PauseRead", server.PauseRead}} {
+		t.Run(tc.name, func(t *testing.T) {
+			h, send := startAsync(t, tc.strategy)
+			send(apiBarrier, "b")
+			for _, s := range []string{"1", "2", "3", "4", "5"} {
+				send(apiPlain, s)
+			}
+			expectMsgs(t, h.recv, rxMsg{apiBarrier, []byte("b")})
+			close(h.gate)
+			// 排空期间再次进入忙碌：其后的消息在第二个任务完成后交付
+			send(apiPlain, "6")
+			expectMsgs(t, h.recv, msgs(apiPlain, "1", "2", "3", "4", "5", "6")...)
+			send(apiBarrier, "b2")
+			send(apiPlain, "7")
+			expectMsgs(t, h.recv, append([]rxMsg{{apiBarrier, []byte("b2")}}, msgs(apiPlain, "7")...)...)
+		})
+	}
+}
+
+// TestAsyncOffload 校验返回 false 时 c.Go 的任务不阻塞后续消息。
+func TestAsyncOffload(t *testing.T) {
+	h, send := startAsync(t, server.PauseRead)
+	send(apiOffload, "o")
+	send(apiPlain, "1")
+	expectMsgs(t, h.recv, rxMsg{apiOffload, []byte("o")}, rxMsg{apiPlain, []byte("1")})
+	// 任务仍在运行时返回 async=true，等待该任务完成
+	send(apiNoTask, "n")
+	send(apiPlain, "2")
+	expectMsgs(t, h.recv, rxMsg{apiNoTask, []byte("n")})
+	close(h.gate)
+	expectMsgs(t, h.recv, rxMsg{apiPlain, []byte("2")})
+}
+
+// TestAsyncWithoutTask 校验没有未完成任务时返回 async=true 不会使连接永久积压。
+func TestAsyncWithoutTask(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		strategy server.AsyncStrategy
+	}{{"CopyToPool", server.CopyToPool}, {"PauseRead", server.PauseRead}} {
+		t.Run(tc.name, func(t *testing.T) {
+			h, send := startAsync(t, tc.strategy)
+			send(apiNoTask, "n")
+			send(apiPlain, "1")
+			send(apiDone, "d")
+			send(apiPlain, "2")
+			expectMsgs(t, h.recv, rxMsg{apiNoTask, []byte("n")}, rxMsg{apiPlain, []byte("1")},
+				rxMsg{apiDone, []byte("d")}, rxMsg{apiPlain, []byte("2")})
+		})
+	}
+}
+
+// TestAsyncTaskError 校验任务返回错误时连接以该错误关闭，积压的消息不再交付。
+func TestAsyncTaskError(t *testing.T) {
+	h, send := startAsync(t, server.CopyToPool)
+	send(apiFail, "f")
+	send(apiPlain, "1")
+	expectMsgs(t, h.recv, rxMsg{apiFail, []byte("f")})
+	close(h.gate)
+	select {
+	case err := <-h.closed:
+		if !errors.Is(err, errTask) {
+			t.Fatalf("OnClose err = %v, want %v", err, errTask)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection not closed")
+	}
+	expectMsgs(t, h.recv)
+}
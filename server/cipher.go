@@ -0,0 +1,71 @@
+package server
+
+import (
+	"time"
+
+	"github.com/legamerdc/gio/protocol"
+)
+
+// 原地加解密钩子（design.md: 安全与加密）：Config.NewCipher 非 nil 时，
+// 每个连接持有独立的 Cipher 实例（Conn.Data）。
+//   - 发送：每条业务消息的明文负载在压缩与组帧之前 EncryptInPlace，
+//     在 agg.mu 下进行，加密顺序即线路顺序；
+//   - 接收：帧切分并解压后、交付业务（或进入积压）之前 DecryptInPlace。
+//
+// 控制帧（心跳、GOAWAY 等）不经过 Cipher。加密与解密分别在写入方与
+// poller goroutine 中调用，Cipher 实现需各自维护两个方向的状态。
+
+func (s *Server[C]) ciphered() bool { return s.cfg.NewCipher != nil }
+
+// sealLocked 将 msg 拷入发送侧暂存并加密，返回的切片在下一次调用前有效；调用方持有 agg.mu。
+func (c *connection[C]) sealLocked(msg []byte) []byte {
+	c.txScratch = append(c.txScratch[:0], msg...)
+	c.api.Data.EncryptInPlace(c.txScratch)
+	return c.txScratch
+}
+
+// recodeLocked 将已编码的帧（业务预压缩、预合并或共享帧）以 from 拆开，逐条加密（如启用）后
+// 按原有压缩/批量语义以本连接的压缩算法重新编码并追加到 dst；调用方持有 agg.mu。
+// 负载拆出时已拷贝，dst 可与 frame 共用底层数组。
+func (c *connection[C]) recodeLocked(dst, frame []byte, from protocol.Compressor) ([]byte, error) {
+	_, _, compressed, batched, err := protocol.DecodeLenFlags(frame)
+	if err != nil {
+		return dst, err
+	}
+	if c.recode == nil {
+		c.recode = newTxAggregator(0, 0)
+		c.txPrs, _ = protocol.NewParser()
+	}
+	r := c.recode
+	defer r.reset()
+	if from != nil {
+		c.txPrs.SetCompressor(from)
+	}
+	n, err := c.txPrs.ParseFrame(frame, func(api uint16, p []byte) error {
+		r.add(api, p, time.Time{})
+		return nil
+	})
+	if err != nil {
+		return dst, err
+	}
+	if n != len(frame) {
+		return dst, protocol.ErrIncomplete
+	}
+	items := r.take()
+	if c.srv.ciphered() {
+		for _, it := range items {
+			c.api.Data.EncryptInPlace(it.Payload)
+		}
+	}
+	if batched {
+		return c.enc.AppendBatch(dst, items)
+	}
+	if len(items) != 1 {
+		return dst, protocol.ErrIncomplete
+	}
+	var f protocol.Flags
+	if compressed {
+		f = protocol.FlagCompress
+	}
+	return c.enc.AppendSingle(dst, items[0].Api, items[0].Payload, f)
+}
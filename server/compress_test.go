@@ -0,0 +1,75 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/legamerdc/gio/client"
+	"github.com/legamerdc/gio/server"
+)
+
+// compHandler 回显压缩后的消息，并在 OnOpen 中报告连接使用的压缩算法。
+type compHandler struct {
+	echoHandler
+	algo chan string
+}
+
+func (h *compHandler) OnOpen(c *server.Conn[nopCipher]) { h.algo <- c.Compressor().Name() }
+
+// TestCompressionNegotiation 校验握手选用双方共有的算法：提议位于 CompressionAllowed 中时采用提议，
+// 否则回退为服务端的 CompressionAlgo，且两端以选定算法互通。
+func TestCompressionNegotiation(t *testing.T) {
+	addr := freeAddr(t)
+	h := &compHandler{algo: make(chan string, 1)}
+	srv, err := server.Start[nopCipher](server.Config[nopCipher]{
+		ListenNetwork:      "tcp",
+		ListenAddress:      addr,
+		Handshake:          true,
+		CompressionAlgo:    "zstd",
+		CompressionAllowed: []string{"s2", "deflate"},
+	}, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop(context.Background())
+	for _, tc := range []struct{ offer, want string }{
+		{"s2", "s2"},
+		{"deflate", "deflate"},
+		{"snappy", "zstd"}, // 已注册但服务端不允许
+		{"", "zstd"},
+	} {
+		t.Run(tc.offer, func(t *testing.T) {
+			ch := newClientHandler()
+			c, err := client.DialConfig("tcp", addr, client.Config{Handshake: true, CompressionAlgo: tc.offer}, ch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			if got := c.Compressor().Name(); got != tc.want {
+				t.Fatalf("client uses %q, want %q", got, tc.want)
+			}
+			select {
+			case got := <-h.algo:
+				if got != tc.want {
+					t.Fatalf("server uses %q, want %q", got, tc.want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("OnOpen timeout")
+			}
+			msg := bytes.Repeat([]byte("negotiated "), 1000)
+			if err := c.Write(1, msg); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case got := <-ch.recv:
+				if !bytes.Equal(got, msg) {
+					t.Fatal("echo mismatch")
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("echo timeout")
+			}
+		})
+	}
+}
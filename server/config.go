@@ -1,7 +1,12 @@
 package server
 
 import (
+	"crypto/ecdh"
+	"crypto/tls"
+	"math/bits"
 	"time"
+
+	"github.com/legamerdc/gio/protocol"
 )
 
 type Cipher interface {
@@ -11,21 +16,174 @@ type Cipher interface {
 
 type Handler[C Cipher] interface {
 	OnOpen(c *Conn[C])
+	// OnMessage 在连接所属 poller goroutine 中按到达顺序调用；msg 仅在调用期间有效，
+	// 需要保留时调用 c.Retain。
+	// 返回 async=true 表示业务选择异步分流：此后的消息积压到此前经 c.Go 提交的任务全部完成后
+	// 再按序交付；没有未完成的任务时返回值不起作用。返回 false 时 c.Go 的任务与后续消息并行。
 	OnMessage(c *Conn[C], api uint16, msg []byte) (async bool)
 	OnClose(c *Conn[C], err error)
 }
 
+// AsyncStrategy 决定连接处于异步分流（asyncBusy）期间后续到达消息的处理方式。
+type AsyncStrategy int
+
+const (
+	// CopyToPool 继续读取并切帧，保留消息负载后放入 rxBacklog：批量帧与压缩帧的消息引用
+	// 池化解压缓冲，其余拷贝到 per-poller 字节池。
+	CopyToPool AsyncStrategy = iota
+	// PauseRead 在帧边界暂停解析并关闭该连接的读事件，任务完成后再恢复。
+	PauseRead
+)
+
+// KeyInstaller 可由 Cipher 额外实现：启用 Config.Handshake 时，握手完成后以
+// 本连接派生的共享秘密调用 InstallKeys，之后才回调 OnOpen（见 cipher.Stream）。
+type KeyInstaller interface {
+	InstallKeys(secret, salt []byte) error
+}
+
+// DrainHandler 可由 Handler 额外实现：连接发送队列越过高水位后回落到低水位以下时，
+// 在所属 poller goroutine 中回调 OnDrain，生产者可据此恢复发送。
+type DrainHandler[C Cipher] interface {
+	OnDrain(c *Conn[C])
+}
+
+// BackpressurePolicy 决定发送队列超过高水位时 Conn.Write 的行为。
+type BackpressurePolicy int
+
+const (
+	// BackpressureReject 拒绝入队并返回 ErrBackpressure。
+	BackpressureReject BackpressurePolicy = iota
+	// BackpressureDrop 静默丢弃该消息。
+	BackpressureDrop
+	// BackpressureClose 拒绝入队并以 ErrBackpressure 关闭连接。
+	BackpressureClose
+)
+
 type Config[C Cipher] struct {
-	NumPollers      int
-	RxRingSize      int
-	TxRingSize      int
-	TxBatchWindow   time.Duration
-	TxBatchBytes    int
-	MaxPayload      int
-	TimerWheelTick  time.Duration
-	CompressionAlgo string
-	NewCipher       func() C
-	ListenNetwork   string
-	ListenAddress   string
-	ReusePort       bool
+	NumPollers     int
+	RxRingSize     int
+	TxRingSize     int
+	TxBatchWindow  time.Duration
+	TxBatchBytes   int
+	TxBatchMsgs    int
+	TimerWheelTick time.Duration
+	// 接收方向的解析上限（见 protocol.Limits），违反时以对应错误（protocol.ErrFrameTooLarge 等）关闭连接：
+	// 单条消息负载（解压后）、帧长度（缺省及上限为 RxRingSize 能容纳的最大帧）、单帧解压后字节数、批内消息数
+	MaxPayload          int
+	MaxFrameSize        int
+	MaxDecompressedSize int
+	MaxBatchMsgs        int
+	// 压缩算法名（见 protocol.LookupCompressor），缺省 protocol.DefaultCompression，未注册时 Start 返回错误。
+	// 启用 Handshake 时客户端可提议 CompressionAllowed 中的其他算法，此时该连接以协商结果为准；
+	// 提议不在其中（缺省为空，即只接受 CompressionAlgo）时回退为 CompressionAlgo，
+	// 以免客户端把 zstd-best 等高开销算法强加给共享的 poller
+	CompressionAlgo    string
+	CompressionAllowed []string
+	// >0 时以此窗口（2 的幂，见 protocol.ValidContextWindow）启用上下文接管：延迟批量帧经每连接的
+	// 流式 zstd 压缩，引用此前的流量。启用 Handshake 时由客户端提议、取二者较小的窗口，否则两端须配置相同。
+	// ContextMemoryLimit >0 时为每连接上下文状态（两个方向合计，按实际流量计量，见 protocol.Encoder.ContextMemory）
+	// 的内存上限：运行中超出时该连接停止发送上下文帧、释放流式状态并以 ApiContextReset 通知对端，
+	// 对端随之释放解码状态并同样回退，此后两个方向均为无状态压缩
+	ContextTakeover    int
+	ContextMemoryLimit int
+	// 非 nil 时为每个连接创建独立的 Cipher 实例（Conn.Data），收发的业务负载经其原地加解密
+	NewCipher     func() C
+	ListenNetwork string
+	ListenAddress string
+	ReusePort     bool
+	// 发送队列高/低水位（字节）及超出高水位时的策略
+	TxHighWatermark int
+	TxLowWatermark  int
+	TxBackpressure  BackpressurePolicy
+	// 异步分流期间的积压策略，缺省 CopyToPool
+	AsyncStrategy AsyncStrategy
+	// 排空 rxBacklog 时每轮最多处理的消息数，超出后让出 poller 给其他连接
+	AsyncDrainBatch int
+	// >0 时按此间隔向每个连接发送 ping，pong 用于测量 RTT（Conn.RTT）
+	HeartbeatInterval time.Duration
+	// >0 时连接超过此时长未收到任何数据（含 pong）即以 ErrIdleTimeout 关闭
+	IdleTimeout time.Duration
+	// 为 true 时每个连接须先完成 X25519 握手才会回调 OnOpen，派生的秘密经 KeyInstaller 装入 Cipher
+	// （设置了 NewCipher 时 C 须实现 KeyInstaller，否则 Start 返回 ErrNoKeyInstaller）；
+	// HandshakeKey 为可选的服务端静态私钥，供客户端固定公钥以认证服务端
+	Handshake        bool
+	HandshakeKey     *ecdh.PrivateKey
+	HandshakeTimeout time.Duration
+	// 为 true 时接受客户端在握手中提议的帧级认证（AES-256-GCM）：此后每帧携带认证 tag，
+	// 以隐式序号为 nonce，篡改、重放或乱序的帧以 ErrAuthFailed 关闭连接。需开启 Handshake
+	FrameAEAD bool
+	// 非 nil 时在 poller 驱动的连接上运行 TLS，OnMessage 收到的仍是明文；
+	// TLS 握手须在 HandshakeTimeout 内完成，之后才进行应用层握手（如启用）或回调 OnOpen；
+	// 握手期间缓冲的密文超过约一条最大记录时以 ErrTLSInputOverflow 终止握手
+	TLS *tls.Config
+}
+
+const (
+	defaultRxRingSize       = 64 << 10
+	defaultAsyncDrainBatch  = 64
+	defaultTxBatchWindow    = 10 * time.Millisecond
+	defaultTxBatchBytes     = 32 << 10
+	defaultTxBatchMsgs      = 16
+	defaultTxHighWatermark  = 4 << 20
+	defaultHandshakeTimeout = 5 * time.Second
+)
+
+// normalize 补齐缺省配置。
+func (c *Config[C]) normalize() {
+	if c.NumPollers <= 0 {
+		c.NumPollers = 1
+	}
+	if c.RxRingSize <= 0 {
+		c.RxRingSize = defaultRxRingSize
+	}
+	// 与读环的实际容量一致（向上取整为 2 的幂）
+	c.RxRingSize = 1 << bits.Len(uint(c.RxRingSize-1))
+	if c.AsyncDrainBatch <= 0 {
+		c.AsyncDrainBatch = defaultAsyncDrainBatch
+	}
+	if c.TxBatchWindow <= 0 {
+		c.TxBatchWindow = defaultTxBatchWindow
+	}
+	if c.TxBatchBytes <= 0 {
+		c.TxBatchBytes = defaultTxBatchBytes
+	}
+	if c.TxBatchMsgs <= 0 {
+		c.TxBatchMsgs = defaultTxBatchMsgs
+	}
+	if c.TxHighWatermark <= 0 {
+		c.TxHighWatermark = defaultTxHighWatermark
+	}
+	if c.TxLowWatermark <= 0 || c.TxLowWatermark > c.TxHighWatermark {
+		c.TxLowWatermark = c.TxHighWatermark / 4
+	}
+	if c.HandshakeTimeout <= 0 {
+		c.HandshakeTimeout = defaultHandshakeTimeout
+	}
+	if c.TimerWheelTick <= 0 {
+		c.TimerWheelTick = time.Millisecond
+	}
+	// 放不进读环的帧以 ErrFrameTooLarge 拒绝，而非在环满后以 ErrRxOverflow 关闭
+	if maxFrame := c.RxRingSize - protocol.MaxHeaderLen - 2; c.MaxFrameSize <= 0 || c.MaxFrameSize > maxFrame {
+		c.MaxFrameSize = maxFrame
+	}
+	def := protocol.DefaultLimits()
+	if c.MaxPayload <= 0 {
+		c.MaxPayload = def.MaxMessage
+	}
+	if c.MaxDecompressedSize <= 0 {
+		c.MaxDecompressedSize = def.MaxDecompressed
+	}
+	if c.MaxBatchMsgs <= 0 {
+		c.MaxBatchMsgs = def.MaxBatchMsgs
+	}
+}
+
+// limits 返回连接解析器的上限。
+func (c *Config[C]) limits() protocol.Limits {
+	return protocol.Limits{
+		MaxFrame:        c.MaxFrameSize,
+		MaxDecompressed: c.MaxDecompressedSize,
+		MaxBatchMsgs:    c.MaxBatchMsgs,
+		MaxMessage:      c.MaxPayload,
+	}
 }
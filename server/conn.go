@@ -2,12 +2,13 @@ package server
 
 import (
 	"context"
-	"log"
+	"time"
 
 	"github.com/legamerdc/gio/protocol"
 )
 
 type Conn[C Cipher] struct {
+	// ID 在服务器生命周期内唯一，可用于 Server.Conn / Server.Kick
 	ID   uint64
 	Data C
 
@@ -18,25 +19,103 @@ type Conn[C Cipher] struct {
 
 func (c *Conn[C]) Context() *C { return &c.Data }
 
-func (c *Conn[C]) Write(msg []byte, api uint16, opts ...any) error {
+// Write 发送一条消息，opts 见 Immediate、Delayed、Compress、Compressed、AlreadyMerged；
+// 缺省立即发送。msg 在返回后即可复用。错误（ErrBackpressure、ErrConnClosed 等）只返回给调用方，
+// 不记录日志；未绑定连接的 Conn 返回 ErrConnClosed。
+func (c *Conn[C]) Write(msg []byte, api uint16, opts ...WriteOption) error {
 	if c.enc == nil || c.runtime == nil {
-		log.Printf("server: Conn.Write skip, enc=%v runtime=%v", c.enc != nil, c.runtime != nil)
-		return nil
+		return ErrConnClosed
 	}
-	frame, err := c.enc.EncodeSingle(api, msg, false)
+	o, err := resolveWriteOpts(opts)
 	if err != nil {
-		log.Printf("server: Conn.Write encode error: %v", err)
 		return err
 	}
-	err = c.runtime.enqueueWrite(frame)
-	if err != nil {
-		log.Printf("server: Conn.Write enqueue error: %v", err)
+	if protocol.IsControl(api) && !o.merged {
+		return ErrReservedApi
+	}
+	return c.runtime.write(msg, api, o)
+}
+
+// Retain 只能在 OnMessage 中调用，使本次 msg 在 OnMessage 返回后继续有效，直到返回的引用
+// Release（可在 c.Go 的任务等其他 goroutine 中释放）。批量帧与压缩帧的消息位于池化解压缓冲，
+// 保留时不拷贝；其余消息拷贝一次。引用的 Bytes 与 msg 内容相同。
+func (c *Conn[C]) Retain() protocol.Ref {
+	if c.runtime == nil {
+		return protocol.Ref{}
+	}
+	return c.runtime.retain()
+}
+
+// Compressor 返回本连接使用的压缩算法（Config.CompressionAlgo 或握手协商的结果），
+// 以 Compressed、AlreadyMerged 发送的负载须以它压缩。在 OnOpen 及之后调用。
+func (c *Conn[C]) Compressor() protocol.Compressor {
+	if c.enc == nil {
+		return nil
+	}
+	return c.enc.Compressor()
+}
+
+// RTT 返回由心跳 ping/pong 测得的平滑往返时延与抖动（RFC 6298），
+// 未开启 Config.HeartbeatInterval 或尚无样本时均为 0。可从任意 goroutine 调用。
+func (c *Conn[C]) RTT() (rtt, jitter time.Duration) {
+	if c.runtime == nil {
+		return 0, 0
+	}
+	return c.runtime.rtt.Get()
+}
+
+// Go 将 task 异步分流到 worker 执行。在 OnMessage 中调用且该次 OnMessage 返回 async=true 时
+// 连接进入 AsyncBusy：其后到达的消息按 Config.AsyncStrategy 积压，待任务完成后在所属 poller 上按序交付。
+// 同一连接多次调用 Go 的任务串行执行；task 返回错误时连接以该错误关闭。
+// ctx 在连接关闭时取消。
+func (c *Conn[C]) Go(task func(ctx context.Context) error) {
+	if c.runtime == nil || task == nil {
+		return
 	}
-	return err
+	c.runtime.goAsync(task)
 }
 
-func (c *Conn[C]) Go(task func(ctx context.Context) error) {}
+// AfterFunc 在 d 之后于连接所属 poller goroutine 中执行 fn，可从任意 goroutine 调用。
+// 回调与该连接的 OnMessage 串行，无需加锁；连接关闭后不再触发。
+// 未绑定到运行中连接的 Conn 返回已停止的 Timer，fn 不会执行。
+func (c *Conn[C]) AfterFunc(d time.Duration, fn func()) *Timer {
+	rc := c.runtime
+	if rc == nil {
+		t := &Timer{}
+		t.state.Store(timerStopped)
+		return t
+	}
+	return rc.sh.afterFunc(d, func() {
+		if !rc.closed {
+			fn()
+		}
+	})
+}
 
-func (c *Conn[C]) Flush() error { return nil }
+// Flush 立即将 Delayed 暂存的消息作为一个批量帧发出。
+func (c *Conn[C]) Flush() error {
+	if c.runtime == nil {
+		return nil
+	}
+	return c.runtime.flush()
+}
 
-func (c *Conn[C]) Close() error { return nil }
+// Close 关闭连接，可从任意 goroutine 调用；关闭在所属 poller goroutine 中完成，
+// 已入队的写入不保证发出，OnClose 收到 nil。
+func (c *Conn[C]) Close() error {
+	rc := c.runtime
+	if rc == nil {
+		return nil
+	}
+	rc.sh.post(func() { rc.onClose(nil) })
+	return nil
+}
+
+// closeWith 以 err 关闭连接，OnClose 收到 err；只能在所属 poller goroutine（OnMessage 中）调用。
+// 连接随即标记为关闭中，同一次读取中余下的消息不再交付。
+func (c *Conn[C]) closeWith(err error) {
+	if rc := c.runtime; rc != nil {
+		rc.closing = true
+		rc.sh.post(func() { rc.onClose(err) })
+	}
+}
@@ -1,56 +1,151 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/legamerdc/gio/internal/handshake"
+	"github.com/legamerdc/gio/internal/ring"
+	"github.com/legamerdc/gio/internal/rtt"
 	"github.com/legamerdc/gio/poller"
 	"github.com/legamerdc/gio/protocol"
 	"golang.org/x/sys/unix"
 )
 
 type connection[C Cipher] struct {
-	fd      int
-	srv     *Server[C]
-	mu      sync.Mutex
-	api     Conn[C]
-	enc     *protocol.Encoder
-	prs     *protocol.Parser
-	readBuf [64 << 10]byte
-	// 发送队列（简单版）
-	wq   [][]byte
-	wpos int
-	// 归属 poller
+	fd  int
+	srv *Server[C]
+	mu  sync.Mutex
+	api Conn[C]
+	enc *protocol.Encoder
+	prs *protocol.Parser
+	// 读环形缓冲：跨多次 read 累积半帧，仅交付完整帧
+	rx *ring.Buffer
+	// rx 数据回绕时的线性化暂存，复用以避免分配
+	scratch []byte
+	// 延迟聚合暂存（TxAggregator）
+	agg *txAggregator
+	// 发送侧的加密暂存、认证帧或 TLS 下的组帧暂存，及加密或转码时重新组帧所用的暂存与解析器（按需创建），
+	// 受 agg.mu 保护
+	txScratch []byte
+	txFrame   []byte
+	txSealed  []byte
+	recode    *txAggregator
+	txPrs     *protocol.Parser
+	// 协商启用帧认证后的发送方向状态，受 agg.mu 保护（入队顺序即密封顺序）
+	txAEAD *protocol.FrameAEAD
+	// 已停止发送上下文帧并发出 ApiContextReset，受 agg.mu 保护；
+	// rxCtxMem 为接收方向上下文状态的占用，由 poller goroutine 发布（见 checkContextLocked）
+	ctxReset bool
+	rxCtxMem atomic.Int64
+	// 发送队列：待 writev 的帧，wqBytes 为未写出字节数（用于高/低水位）；
+	// 私有帧直接编码进输出缓冲 wbuf，队列持有其中的分段，写空后复用
+	wq       []txBuf
+	wbuf     []byte
+	iov      [][]byte
+	wpos     int
+	wqBytes  int
+	overHigh bool
+	// EPOLLOUT 已打开 / 读事件暂停（PauseRead 策略），受 mu 保护
+	outOn    bool
+	rxPaused bool
+	fdClosed bool
+	// 非 nil 时发送队列写空即以其关闭连接（见 closeAfterFlush），受 mu 保护
+	closeErr error
+	// 归属 poller 及其分片
 	pl poller.Poller
-}
+	sh *srvShard[C]
 
-func newConnection[C Cipher](fd int, s *Server[C]) *connection[C] {
-	enc, _ := protocol.NewEncoder()
-	prs, _ := protocol.NewParser()
-	c := &connection[C]{fd: fd, srv: s, enc: enc, prs: prs}
-	c.api = Conn[C]{ID: uint64(fd), runtime: c, enc: enc}
-	return c
+	// 异步分流：状态机、待执行任务与积压消息（design.md: Conn.Go 异步状态机）
+	async       atomic.Int32
+	taskMu      sync.Mutex
+	tasks       []func(ctx context.Context) error
+	taskRunning bool
+	backlog     []rxMsg
+	blHead      int
+	// 正在交付的积压消息的负载引用（drain 期间），供 Conn.Retain 使用
+	rxRef   protocol.Ref
+	rxDrain bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	closed  bool
+	// 已决定关闭、正等待发送队列写空：不再交付消息，仅在 poller goroutine 中访问
+	closing bool
+	// 已订阅的主题，仅在 poller goroutine 中访问
+	topics map[string]struct{}
+	// 最后一次收到数据的时刻（空闲检测），仅在 poller goroutine 中访问
+	lastRx time.Time
+	// 由心跳 ping/pong 测得的平滑 RTT 与抖动
+	rtt rtt.Estimator
+	// 握手尚未完成；hs 为已回复 ServerHello、等待 Finished 的状态。仅在 poller goroutine 中访问
+	hsPending bool
+	hs        *handshake.Server
+	// Config.TLS：tls.Conn 及其内存 shim，tlsPending 表示 TLS 握手尚未完成（仅 poller goroutine 访问）
+	tls        *tls.Conn
+	shim       *tlsShim
+	tlsPending bool
 }
 
 func newConnectionShard[C Cipher](fd int, s *Server[C], idx int) *connection[C] {
 	enc, _ := protocol.NewEncoder()
 	prs, _ := protocol.NewParser()
-	c := &connection[C]{fd: fd, srv: s, enc: enc, prs: prs, pl: s.pls[idx]}
-	c.api = Conn[C]{ID: uint64(fd), runtime: c, enc: enc}
+	enc.SetCompressor(s.comp)
+	prs.SetCompressor(s.comp)
+	prs.SetLimits(s.cfg.limits())
+	prs.SetBufferPool(s.shards[idx].pool)
+	c := &connection[C]{fd: fd, srv: s, enc: enc, prs: prs, rx: ring.New(s.cfg.RxRingSize), pl: s.pls[idx], sh: s.shards[idx]}
+	c.agg = newTxAggregator(s.cfg.TxBatchBytes, s.cfg.TxBatchMsgs)
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.lastRx = time.Now()
+	c.api = Conn[C]{ID: s.nextConnID(idx), runtime: c, enc: enc}
+	if s.ciphered() {
+		c.api.Data = s.cfg.NewCipher()
+	}
+	c.hsPending = s.cfg.Handshake
+	if !s.cfg.Handshake {
+		// 无握手时两端按相同配置各自决定
+		if w := s.selectContext(s.cfg.ContextTakeover); w > 0 {
+			c.setContext(w)
+		}
+	}
+	if s.cfg.TLS != nil {
+		c.initTLS()
+	}
 	return c
 }
 
 func (c *connection[C]) onReadable() {
+	if c.closed || c.readPaused() {
+		return
+	}
+	if c.tls != nil {
+		c.onReadableTLS()
+		return
+	}
 	for {
-		n, err := unix.Read(c.fd, c.readBuf[:])
-		log.Printf("server: read fd=%d n=%d err=%v", c.fd, n, err)
+		w := c.rx.WritableSlice()
+		if len(w) == 0 {
+			// 环已满却解析不出完整帧：单帧超出环容量
+			c.onClose(ErrRxOverflow)
+			return
+		}
+		n, err := unix.Read(c.fd, w)
 		if n > 0 {
-			buf := c.readBuf[:n]
-			_, _ = c.prs.Parse(buf, func(api uint16, payload []byte) error {
-				async := c.srv.h.OnMessage(&c.api, api, payload)
-				_ = async
-				return nil
-			})
+			c.lastRx = time.Now()
+			c.rx.Commit(n)
+			if perr := c.parseRx(); perr != nil {
+				c.onClose(perr)
+				return
+			}
+			if c.closed || c.readPaused() {
+				// PauseRead 已在帧边界暂停，剩余数据留在内核缓冲
+				return
+			}
 		}
 		if err != nil {
 			if err == unix.EAGAIN || err == unix.EWOULDBLOCK {
@@ -66,60 +161,546 @@ func (c *connection[C]) onReadable() {
 	}
 }
 
+// parseRx 解析 rx 中所有完整帧并交付，未消费的半帧留在环内等待后续数据。
+func (c *connection[C]) parseRx() error {
+	first, second := c.rx.Slices()
+	buf := first
+	if len(second) > 0 {
+		c.scratch = append(append(c.scratch[:0], first...), second...)
+		buf = c.scratch
+	}
+	consumed := 0
+	for {
+		n, err := c.prs.ParseFrame(buf[consumed:], c.onMessage)
+		consumed += n
+		if err != nil {
+			c.rx.Discard(consumed)
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		c.noteRxContext()
+		// PauseRead：忙碌期间停在帧边界，剩余字节留在环内
+		if c.srv.cfg.AsyncStrategy == PauseRead && c.async.Load() != asyncIdle {
+			c.rx.Discard(consumed)
+			c.pauseRead()
+			return nil
+		}
+	}
+	c.rx.Discard(consumed)
+	// 剩余半帧若已可判定长度，提前检查能否放入环
+	if rest := buf[consumed:]; len(rest) >= 2 {
+		hl, length, _, batched, herr := protocol.DecodeLenFlags(rest)
+		if herr == nil {
+			need := hl + length
+			if !batched {
+				need += 2
+			}
+			if need > c.rx.Cap() {
+				return ErrRxOverflow
+			}
+		}
+	}
+	return nil
+}
+
+func (c *connection[C]) onMessage(api uint16, payload []byte) error {
+	if c.closing {
+		return nil
+	}
+	if protocol.IsControl(api) {
+		// 控制帧由框架处理，不进入积压也不交付业务
+		return c.onControl(api, payload)
+	}
+	if c.hsPending {
+		return fmt.Errorf("%w: application message before handshake", ErrHandshakeFailed)
+	}
+	if c.srv.ciphered() {
+		// 按到达顺序解密，之后再进入积压或交付
+		c.api.Data.DecryptInPlace(payload)
+	}
+	if c.async.Load() != asyncIdle {
+		// 忙碌或排空中：保持顺序，先入 rxBacklog
+		c.pushBacklog(api)
+		return nil
+	}
+	c.deliver(api, payload)
+	return nil
+}
+
+// deliver 同步调用业务处理，返回 async=true 时经 enterBusy 进入 AsyncBusy。
+func (c *connection[C]) deliver(api uint16, payload []byte) {
+	if c.srv.h.OnMessage(&c.api, api, payload) {
+		c.enterBusy()
+	}
+}
+
+// iovMax 为单次 writev 的最大分段数（IOV_MAX）。
+const iovMax = 1024
+
+// outBufKeep 为队列写空后保留的输出缓冲容量上限。
+const outBufKeep = 256 << 10
+
 func (c *connection[C]) onWritable() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.flushQueueLocked()
+}
+
+// txFrame 描述一个待编码的私有帧：batch 非 nil 时为批量帧，merged 为业务已合并压缩的批量帧，
+// 否则为按 flags 编码的单帧。
+type txFrame struct {
+	api    uint16
+	msg    []byte
+	flags  protocol.Flags
+	merged bool
+	batch  []protocol.BatchItem
+}
+
+func (c *connection[C]) appendFrame(dst []byte, f *txFrame) ([]byte, error) {
+	switch {
+	case f.batch != nil:
+		return c.enc.AppendBatch(dst, f.batch)
+	case f.merged:
+		return c.enc.AppendFrame(dst, 0, f.msg, true, true)
+	default:
+		return c.enc.AppendSingle(dst, f.api, f.msg, f.flags)
+	}
+}
+
+// enqueueFrame 编码 f 并入队，调用方持有 agg.mu。明文连接在 mu 下直接编码进输出缓冲，
+// 稳态下不分配内存；认证帧与 TLS 先编码到暂存，再经 enqueueWrite 密封或加密。
+// 水位检查在 Conn.Write 入口进行，框架内部帧（批量刷新等）总是入队。
+func (c *connection[C]) enqueueFrame(f *txFrame) error {
+	if c.txAEAD != nil || c.tls != nil {
+		frame, err := c.appendFrame(c.txFrame[:0], f)
+		c.txFrame = frame[:0]
+		if err != nil {
+			return err
+		}
+		return c.enqueueWrite(frame)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fdClosed {
+		return ErrConnClosed
+	}
+	c.trimOutLocked()
+	start := len(c.wbuf)
+	out, err := c.appendFrame(c.wbuf, f)
+	if err != nil {
+		return err
+	}
+	c.wbuf = out
+	c.pushLocked(txBuf{b: out[start:len(out):len(out)]})
+	return nil
+}
+
+// enqueueWrite 将已编码的帧（调用方的暂存，返回后即可复用）密封或拷贝进输出缓冲并入队；
+// TLS 模式下经 tls.Conn 加密，密文由 shim 拷贝入队。调用方持有 agg.mu。
+func (c *connection[C]) enqueueWrite(frame []byte) error {
+	if c.txAEAD != nil {
+		if c.tls == nil {
+			return c.sealOut(frame)
+		}
+		sealed, err := c.txAEAD.Seal(c.txSealed[:0], frame)
+		if err != nil {
+			return err
+		}
+		c.txSealed = sealed[:0]
+		frame = sealed
+	}
+	if c.tls != nil {
+		_, err := c.tls.Write(frame)
+		return err
+	}
+	return c.enqueueCopy(frame)
+}
+
+// sealOut 将帧直接密封进输出缓冲并入队。
+func (c *connection[C]) sealOut(frame []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fdClosed {
+		return ErrConnClosed
+	}
+	c.trimOutLocked()
+	start := len(c.wbuf)
+	out, err := c.txAEAD.Seal(c.wbuf, frame)
+	if err != nil {
+		return err
+	}
+	c.wbuf = out
+	c.pushLocked(txBuf{b: out[start:len(out):len(out)]})
+	return nil
+}
+
+// enqueueCopy 将 b 拷贝进输出缓冲并入队（已编码的暂存帧、tls shim 的密文）。
+func (c *connection[C]) enqueueCopy(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fdClosed {
+		return ErrConnClosed
+	}
+	c.trimOutLocked()
+	start := len(c.wbuf)
+	c.wbuf = append(c.wbuf, b...)
+	c.pushLocked(txBuf{b: c.wbuf[start:len(c.wbuf):len(c.wbuf)]})
+	return nil
+}
+
+// trimOutLocked 在队列持续未写空、输出缓冲大半为已写出的前缀时改用新缓冲，
+// 旧缓冲由队列中尚未写出的分段引用，写完后交还 GC。
+func (c *connection[C]) trimOutLocked() {
+	if len(c.wbuf) > outBufKeep && len(c.wbuf) > 2*c.wqBytes {
+		c.wbuf = nil
+	}
+}
+
+// enqueueShared 入队共享帧并持有一个引用，写完或连接关闭时释放。
+// 认证帧或 TLS 模式下每帧须按本连接的状态加密，退化为拷贝。
+func (c *connection[C]) enqueueShared(p *SharedPayload) error {
+	if c.txAEAD != nil || c.tls != nil {
+		return c.enqueueWrite(p.frame)
+	}
+	p.retain()
+	if err := c.enqueue(txBuf{b: p.frame, sp: p}); err != nil {
+		p.Release()
+		return err
+	}
+	return nil
+}
+
+func (c *connection[C]) enqueue(tb txBuf) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fdClosed {
+		return ErrConnClosed
+	}
+	c.pushLocked(tb)
+	return nil
+}
+
+// pushLocked 将一段追加到发送队列；EPOLLOUT 未打开时立即尝试写出。调用方持有 mu。
+func (c *connection[C]) pushLocked(tb txBuf) {
+	c.wq = append(c.wq, tb)
+	c.wqBytes += len(tb.b)
+	if c.wqBytes >= c.srv.cfg.TxHighWatermark {
+		c.overHigh = true
+	}
+	if !c.outOn {
+		c.flushQueueLocked()
+	}
+}
+
+// flushQueueLocked 以 writev 批量写出队列（每次最多 iovMax 段），直到写空或 EAGAIN；
+// 未写完时打开 EPOLLOUT，写空后立即关闭。调用方持有 mu。
+func (c *connection[C]) flushQueueLocked() {
 	for c.wpos < len(c.wq) {
-		b := c.wq[c.wpos]
-		n, err := unix.Write(c.fd, b)
-		log.Printf("server: write fd=%d n=%d err=%v", c.fd, n, err)
+		iov := c.iov[:0]
+		for _, tb := range c.wq[c.wpos:min(len(c.wq), c.wpos+iovMax)] {
+			iov = append(iov, tb.b)
+		}
+		n, err := unix.Writev(c.fd, iov)
+		clear(iov)
+		c.iov = iov[:0]
 		if n > 0 {
-			if n == len(b) {
-				c.wpos++
-				continue
-			}
-			c.wq[c.wpos] = b[n:]
+			c.consumeLocked(n)
+		}
+		if err == unix.EINTR {
+			continue
+		}
+		if err == unix.EAGAIN || err == unix.EWOULDBLOCK || (err == nil && n == 0) {
+			c.setWritableLocked(true)
+			c.checkDrainLocked()
 			return
 		}
-		if err == unix.EAGAIN || err == unix.EWOULDBLOCK {
+		if err != nil {
+			c.sh.post(func() { c.onClose(err) })
 			return
 		}
+	}
+	c.wq = c.wq[:0]
+	c.wpos = 0
+	// 队列已写空，输出缓冲不再被引用；突发后的大缓冲交还 GC
+	c.wbuf = c.wbuf[:0]
+	if cap(c.wbuf) > outBufKeep {
+		c.wbuf = nil
+	}
+	c.setWritableLocked(false)
+	c.checkDrainLocked()
+	if err := c.closeErr; err != nil {
+		c.sh.post(func() { c.onClose(err) })
+	}
+}
+
+// closeFlushTimeout 为 closeAfterFlush 等待发送队列写空的最长时间。
+const closeFlushTimeout = time.Second
+
+// closeAfterFlush 在 poller goroutine 中以 err 关闭连接，但先等待发送队列（含刚入队的 GOAWAY）
+// 写空，最迟 closeFlushTimeout 后强制关闭；其间不再交付收到的消息。
+func (c *connection[C]) closeAfterFlush(err error) {
+	if c.closed {
+		return
+	}
+	c.closing = true
+	c.mu.Lock()
+	pending := c.wpos < len(c.wq) && !c.fdClosed
+	if pending {
+		c.closeErr = err
+	}
+	c.mu.Unlock()
+	if !pending {
 		c.onClose(err)
 		return
 	}
-	// 全部写完，关闭 EPOLLOUT
-	if c.pl != nil {
-		_ = c.pl.Mod(c.fd, true, false)
+	c.sh.afterFunc(closeFlushTimeout, func() { c.onClose(err) })
+}
+
+// consumeLocked 从队首移除已写出的 n 字节。
+func (c *connection[C]) consumeLocked(n int) {
+	c.wqBytes -= n
+	for n > 0 {
+		tb := c.wq[c.wpos]
+		if n < len(tb.b) {
+			c.wq[c.wpos].b = tb.b[n:]
+			break
+		}
+		n -= len(tb.b)
+		tb.release()
+		c.wq[c.wpos] = txBuf{}
+		c.wpos++
 	}
-	// 压缩队列
-	if c.wpos > 0 {
-		c.wq = c.wq[c.wpos:]
+	// 已写出的前缀过长时压缩队列
+	if c.wpos > 64 && c.wpos*2 > len(c.wq) {
+		m := copy(c.wq, c.wq[c.wpos:])
+		clear(c.wq[m:])
+		c.wq = c.wq[:m]
 		c.wpos = 0
 	}
 }
 
-func (c *connection[C]) enqueueWrite(frame []byte) error {
+// setWritableLocked 按需切换 EPOLLOUT，避免重复的 epoll_ctl。
+func (c *connection[C]) setWritableLocked(on bool) {
+	if c.outOn == on {
+		return
+	}
+	c.outOn = on
+	if c.pl != nil {
+		_ = c.pl.Mod(c.fd, !c.rxPaused, on)
+	}
+}
+
+// checkDrainLocked 在越过高水位后回落到低水位以下时，于 poller goroutine 中回调 OnDrain。
+func (c *connection[C]) checkDrainLocked() {
+	if !c.overHigh || c.wqBytes > c.srv.cfg.TxLowWatermark {
+		return
+	}
+	c.overHigh = false
+	if dh, ok := c.srv.h.(DrainHandler[C]); ok {
+		c.sh.post(func() {
+			if !c.closed {
+				dh.OnDrain(&c.api)
+			}
+		})
+	}
+}
+
+// admit 在 Conn.Write 入口检查发送高水位，超出时按 Config.TxBackpressure 处理：
+// 返回 false 表示消息不应入队，err 为应返回给调用方的错误。
+func (c *connection[C]) admit() (ok bool, err error) {
 	c.mu.Lock()
-	c.wq = append(c.wq, frame)
-	needOut := len(c.wq) == 1
+	over := c.wqBytes >= c.srv.cfg.TxHighWatermark
+	if over {
+		c.overHigh = true
+	}
 	c.mu.Unlock()
-	if needOut {
-		// 尝试立即写
-		c.onWritable()
-		// 若未清空则打开 EPOLLOUT
-		c.mu.Lock()
-		pend := c.wpos < len(c.wq)
-		c.mu.Unlock()
-		if pend && c.pl != nil {
-			_ = c.pl.Mod(c.fd, true, true)
+	if !over {
+		return true, nil
+	}
+	switch c.srv.cfg.TxBackpressure {
+	case BackpressureDrop:
+		return false, nil
+	case BackpressureClose:
+		c.sh.post(func() { c.onClose(ErrBackpressure) })
+	}
+	return false, ErrBackpressure
+}
+
+// write 按发送语义编码并入队；立即发送前先刷出已暂存的延迟消息以保持顺序。
+func (c *connection[C]) write(msg []byte, api uint16, o writeOpts) error {
+	if ok, err := c.admit(); !ok {
+		return err
+	}
+	a := c.agg
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if o.delayed {
+		window := o.window
+		if window <= 0 {
+			window = c.srv.cfg.TxBatchWindow
 		}
+		sched, full := a.add(api, msg, time.Now().Add(window))
+		if c.srv.ciphered() {
+			c.api.Data.EncryptInPlace(a.buf[len(a.buf)-len(msg):])
+		}
+		if full {
+			return c.flushLocked()
+		}
+		if sched {
+			// 登记到所属 poller 的时间轮，不创建 per-connection 定时器对象以外的资源
+			c.sh.afterFunc(window, c.flushDue)
+		}
+		return nil
 	}
-	return nil
+	if err := c.flushLocked(); err != nil {
+		return err
+	}
+	f := txFrame{api: api, msg: msg}
+	switch {
+	case o.merged:
+		f.merged = true
+	case o.compressed:
+		f.flags = protocol.FlagCompressed
+	default:
+		if c.srv.ciphered() {
+			f.msg = c.sealLocked(msg)
+		}
+		if o.compress {
+			f.flags = protocol.FlagCompress
+		}
+	}
+	if c.srv.ciphered() && (o.merged || o.compressed) {
+		// 业务预压缩的负载须先还原明文再加密
+		frame, err := c.appendFrame(c.txFrame[:0], &f)
+		if err == nil {
+			frame, err = c.recodeLocked(frame[:0], frame, c.enc.Compressor())
+		}
+		c.txFrame = frame[:0]
+		if err != nil {
+			return err
+		}
+		err = c.enqueueWrite(frame)
+		c.checkContextLocked()
+		return err
+	}
+	return c.enqueueFrame(&f)
+}
+
+// writeShared 入队共享帧；与立即发送一样先刷出暂存消息以保持顺序。
+func (c *connection[C]) writeShared(p *SharedPayload) error {
+	if ok, err := c.admit(); !ok {
+		return err
+	}
+	a := c.agg
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := c.flushLocked(); err != nil {
+		return err
+	}
+	if c.srv.ciphered() || (p.comp != nil && p.comp != c.enc.Compressor()) {
+		// 共享帧不能跨连接加密，压缩算法与本连接协商的不同时也须转码：按本连接重新组帧
+		frame, err := c.recodeLocked(c.txFrame[:0], p.frame, p.comp)
+		c.txFrame = frame[:0]
+		if err != nil {
+			return err
+		}
+		err = c.enqueueWrite(frame)
+		c.checkContextLocked()
+		return err
+	}
+	return c.enqueueShared(p)
+}
+
+// flush 立即刷出暂存的延迟消息。
+func (c *connection[C]) flush() error {
+	c.agg.mu.Lock()
+	defer c.agg.mu.Unlock()
+	return c.flushLocked()
+}
+
+// flushDue 由时间轮在 poller goroutine 中回调：批窗口到期则刷出。
+// 已被阈值或 Flush 提前刷出的批，其残留定时器在此处空转。
+func (c *connection[C]) flushDue() {
+	if c.closed {
+		return
+	}
+	a := c.agg
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.queue) == 0 || time.Now().Before(a.deadline) {
+		return
+	}
+	if err := c.flushLocked(); err != nil {
+		log.Printf("server: tx flush error: %v", err)
+	}
+}
+
+// flushLocked 将暂存消息编码为一个批量压缩帧并入队，调用方持有 agg.mu。
+func (c *connection[C]) flushLocked() error {
+	a := c.agg
+	if len(a.queue) == 0 {
+		return nil
+	}
+	f := txFrame{batch: a.take()}
+	err := c.enqueueFrame(&f)
+	a.reset()
+	c.checkContextLocked()
+	return err
 }
 
+// goAway 刷出暂存消息后发送 GOAWAY 控制帧，通知客户端主动断开。
+func (c *connection[C]) goAway(reason string) {
+	if c.tlsPending {
+		// TLS 握手未完成时无法加密写出，也不能阻塞 poller 等待握手
+		return
+	}
+	a := c.agg
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := c.flushLocked(); err != nil {
+		log.Printf("server: tx flush error: %v", err)
+	}
+	_ = c.writeControlLocked(protocol.ApiGoAway, []byte(reason))
+}
+
+// onClose 在 poller goroutine 中关闭连接，幂等。
+// 先从注册表摘除再关闭 fd，避免 fd 号被其他 poller 复用后误删新连接。
 func (c *connection[C]) onClose(err error) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	if err == nil && c.hsPending {
+		err = fmt.Errorf("%w: connection closed", ErrHandshakeFailed)
+	}
+	c.srv.conns.CompareAndDelete(c.fd, c)
+	c.srv.ids.CompareAndDelete(c.api.ID, c)
+	c.srv.nconns.Add(-1)
+	c.sh.unsubscribeAll(c)
+	c.cancel()
+	c.releaseBacklog()
+	// 持锁关闭 fd：其他 goroutine 的写入不会再触及该 fd 号
+	c.mu.Lock()
+	for i := c.wpos; i < len(c.wq); i++ {
+		c.wq[i].release()
+	}
+	c.wq, c.wpos, c.wqBytes = nil, 0, 0
+	c.wbuf = nil
+	c.fdClosed = true
+	if c.pl != nil {
+		_ = c.pl.Unregister(c.fd)
+	}
 	unix.Close(c.fd)
+	c.mu.Unlock()
+	if c.shim != nil {
+		c.shim.Close()
+	}
 	c.prs.Close()
 	c.enc.Close()
+	if c.txPrs != nil {
+		c.txPrs.Close()
+	}
 	c.srv.h.OnClose(&c.api, err)
 }
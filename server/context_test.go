@@ -0,0 +1,215 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/legamerdc/gio/protocol"
+	"github.com/legamerdc/gio/server"
+)
+
+const testWindow = 64 << 10
+
+// ctxPeer 为静态启用上下文接管的裸 TCP 对端，记录收到的帧类型与消息。
+type ctxPeer struct {
+	t     *testing.T
+	nc    net.Conn
+	prs   *protocol.Parser
+	buf   []byte
+	kinds []string
+	msgs  []rxMsg
+}
+
+func dialCtxPeer(t *testing.T, addr string) *ctxPeer {
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	prs, _ := protocol.NewParser()
+	if err := prs.SetContext(testWindow); err != nil {
+		t.Fatal(err)
+	}
+	return &ctxPeer{t: t, nc: nc, prs: prs}
+}
+
+// readMsgs 读取并解析帧，直到累计收到 n 条业务消息。
+func (p *ctxPeer) readMsgs(n int) {
+	p.t.Helper()
+	_ = p.nc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	tmp := make([]byte, 64<<10)
+	for len(p.msgs) < n {
+		m, err := p.nc.Read(tmp)
+		if err != nil {
+			p.t.Fatalf("read after %d msgs (frames %v): %v", len(p.msgs), p.kinds, err)
+		}
+		p.buf = append(p.buf, tmp[:m]...)
+		for {
+			f, ok, err := protocol.PeekFrame(p.buf)
+			if err != nil {
+				p.t.Fatal(err)
+			}
+			if !ok {
+				break
+			}
+			switch {
+			case f.Batched && !f.Compressed:
+				p.kinds = append(p.kinds, "ctx")
+			case f.Batched:
+				p.kinds = append(p.kinds, "batch")
+			case f.Api() == protocol.ApiContextReset:
+				p.kinds = append(p.kinds, "reset")
+			default:
+				p.kinds = append(p.kinds, "single")
+			}
+			if _, err := p.prs.ParseFrame(f.Raw, p.onMessage); err != nil {
+				p.t.Fatalf("parse frame %d (%v): %v", len(p.kinds), p.kinds, err)
+			}
+			p.buf = p.buf[f.Size():]
+		}
+	}
+}
+
+func (p *ctxPeer) onMessage(api uint16, msg []byte) error {
+	if api == protocol.ApiContextReset {
+		p.prs.ResetContext()
+		return nil
+	}
+	p.msgs = append(p.msgs, rxMsg{api, append([]byte(nil), msg...)})
+	return nil
+}
+
+func (p *ctxPeer) sendReset() {
+	p.t.Helper()
+	enc, _ := protocol.NewEncoder()
+	f, _ := enc.EncodeSingle(protocol.ApiContextReset, nil, false)
+	if _, err := p.nc.Write(f); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+// count 返回 kinds 中 k 的个数。
+func (p *ctxPeer) count(k string) int {
+	n := 0
+	for _, x := range p.kinds {
+		if x == k {
+			n++
+		}
+	}
+	return n
+}
+
+func startCtxServer(t *testing.T, limit int) (*ctxPeer, *server.Conn[nopCipher]) {
+	t.Helper()
+	addr := freeAddr(t)
+	h := openHandler{opened: make(chan *server.Conn[nopCipher], 1)}
+	srv, err := server.Start[nopCipher](server.Config[nopCipher]{
+		ListenNetwork:      "tcp",
+		ListenAddress:      addr,
+		ContextTakeover:    testWindow,
+		ContextMemoryLimit: limit,
+	}, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Stop(context.Background()) })
+	p := dialCtxPeer(t, addr)
+	select {
+	case c := <-h.opened:
+		return p, c
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnOpen timeout")
+	}
+	return nil, nil
+}
+
+// sendBatches 以延迟写入发出 n 个各含一条消息的批量帧，消息编号从 from 起。
+func sendBatches(t *testing.T, c *server.Conn[nopCipher], from, n int) {
+	t.Helper()
+	for i := from; i < from+n; i++ {
+		if err := c.Write(ctxMsg(i), uint16(i), server.Delayed(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func ctxMsg(i int) []byte {
+	return bytes.Repeat([]byte(fmt.Sprintf("message %d;", i)), 400)
+}
+
+func checkMsgs(t *testing.T, msgs []rxMsg) {
+	t.Helper()
+	for i, m := range msgs {
+		if m.api != uint16(i) || !bytes.Equal(m.msg, ctxMsg(i)) {
+			t.Fatalf("msg %d: got api %d len %d", i, m.api, len(m.msg))
+		}
+	}
+}
+
+// TestContextMemoryLimit 校验上下文状态超过 ContextMemoryLimit 后服务端在最后一个上下文帧之后发出
+// ApiContextReset，其后只发无状态批量帧，对端的回应不会再引发重置。
+func TestContextMemoryLimit(t *testing.T) {
+	p, c := startCtxServer(t, 256<<10+16<<10)
+	sendBatches(t, c, 0, 20)
+	p.readMsgs(20)
+	checkMsgs(t, p.msgs)
+	ctx, reset := p.count("ctx"), p.count("reset")
+	if ctx == 0 || ctx == 20 || reset != 1 {
+		t.Fatalf("frames %v: want context frames, one reset, then stateless batches", p.kinds)
+	}
+	for i, k := range p.kinds {
+		want := "batch"
+		if i < ctx {
+			want = "ctx"
+		} else if i == ctx {
+			want = "reset"
+		}
+		if k != want {
+			t.Fatalf("frame %d is %s, want %s: %v", i, k, want, p.kinds)
+		}
+	}
+	p.sendReset()
+	sendBatches(t, c, 20, 5)
+	p.readMsgs(25)
+	checkMsgs(t, p.msgs)
+	if p.count("reset") != 1 || p.count("ctx") != ctx {
+		t.Fatalf("frames %v after peer reset", p.kinds)
+	}
+}
+
+// TestContextPeerReset 校验对端发出 ApiContextReset 后服务端回以 ApiContextReset 并回退为无状态批量帧。
+func TestContextPeerReset(t *testing.T) {
+	p, c := startCtxServer(t, 0)
+	sendBatches(t, c, 0, 3)
+	p.readMsgs(3)
+	if p.count("ctx") != 3 {
+		t.Fatalf("frames %v, want 3 context frames", p.kinds)
+	}
+	p.sendReset()
+	// 服务端处理重置后才发出的批量帧必为无状态帧
+	deadline := time.Now().Add(2 * time.Second)
+	for i := 3; p.count("reset") == 0; i++ {
+		if time.Now().After(deadline) {
+			t.Fatalf("no reset from server: %v", p.kinds)
+		}
+		sendBatches(t, c, i, 1)
+		p.readMsgs(i + 1)
+	}
+	n := len(p.msgs)
+	sendBatches(t, c, n, 3)
+	p.readMsgs(n + 3)
+	checkMsgs(t, p.msgs)
+	last := p.kinds[len(p.kinds)-3:]
+	for _, k := range last {
+		if k != "batch" {
+			t.Fatalf("frames %v: want stateless batches after reset", p.kinds)
+		}
+	}
+}
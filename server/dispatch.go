@@ -0,0 +1,49 @@
+package server
+
+import (
+	"log"
+
+	"github.com/legamerdc/gio/protocol"
+)
+
+// Dispatcher 将消息按 api 解码为 protocol.Registry 中登记的类型，交给以 Handle 登记的处理函数。
+// 嵌入 Handler 实现即可作为其 OnMessage：
+//
+//	type handler struct{ *server.Dispatcher[C] }
+//	server.Handle(h.Dispatcher, func(c *server.Conn[C], m *LoginReq) { ... })
+type Dispatcher[C Cipher] struct {
+	d *protocol.Dispatcher[*Conn[C]]
+	// OnError 在 api 未登记（protocol.ErrUnknownApi）或解码失败时调用，缺省记录日志；
+	// 需要断开时在其中调用 c.Close
+	OnError func(c *Conn[C], api uint16, err error)
+}
+
+func NewDispatcher[C Cipher](reg *protocol.Registry) *Dispatcher[C] {
+	return &Dispatcher[C]{d: protocol.NewDispatcher[*Conn[C]](reg)}
+}
+
+// Handle 为 T 登记处理函数，T 须已在 d 的 Registry 中登记；处理函数在 OnMessage 中同步调用，
+// 异步处理时调用 c.Go。
+func Handle[C Cipher, T any](d *Dispatcher[C], fn func(c *Conn[C], m *T)) error {
+	return protocol.Handle(d.d, fn)
+}
+
+// Registry 返回分发所用的登记表。
+func (d *Dispatcher[C]) Registry() *protocol.Registry { return d.d.Registry() }
+
+// Dispatch 解码 msg 并调用 api 的处理函数，见 protocol.Dispatcher.Dispatch。
+func (d *Dispatcher[C]) Dispatch(c *Conn[C], api uint16, msg []byte) error {
+	return d.d.Dispatch(c, api, msg)
+}
+
+// OnMessage 实现 Handler.OnMessage；处理函数调用 c.Go 时连接同样进入异步分流。
+func (d *Dispatcher[C]) OnMessage(c *Conn[C], api uint16, msg []byte) bool {
+	if err := d.d.Dispatch(c, api, msg); err != nil {
+		if d.OnError != nil {
+			d.OnError(c, api, err)
+		} else {
+			log.Printf("server: dispatch error: %v", err)
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/legamerdc/gio/client"
+	"github.com/legamerdc/gio/protocol"
+	"github.com/legamerdc/gio/server"
+)
+
+type chatMsg struct {
+	Text string `json:"text"`
+}
+
+const apiChat uint16 = 10
+
+type dispatchErr struct {
+	api uint16
+	err error
+}
+
+// dispatchHandler 以嵌入的 Dispatcher 作为 OnMessage，分发错误送入 errs。
+type dispatchHandler struct {
+	*server.Dispatcher[nopCipher]
+	errs chan dispatchErr
+}
+
+func (dispatchHandler) OnOpen(c *server.Conn[nopCipher]) {}
+
+func (dispatchHandler) OnClose(c *server.Conn[nopCipher], err error) {}
+
+// TestDispatcherHandler 校验嵌入 Dispatcher 的 Handler 按类型分发消息，未登记 api 与解码失败交给 OnError。
+func TestDispatcherHandler(t *testing.T) {
+	reg := protocol.NewRegistry()
+	if err := protocol.Register(reg, apiChat, protocol.JSON[chatMsg]()); err != nil {
+		t.Fatal(err)
+	}
+	h := dispatchHandler{Dispatcher: server.NewDispatcher[nopCipher](reg), errs: make(chan dispatchErr, 4)}
+	h.OnError = func(c *server.Conn[nopCipher], api uint16, err error) { h.errs <- dispatchErr{api, err} }
+	if err := server.Handle(h.Dispatcher, func(c *server.Conn[nopCipher], m *chatMsg) {
+		m.Text = "echo: " + m.Text
+		api, b, _ := reg.Encode(nil, m)
+		_ = c.Write(b, api)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	addr := freeAddr(t)
+	srv, err := server.Start[nopCipher](server.Config[nopCipher]{ListenNetwork: "tcp", ListenAddress: addr}, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop(context.Background())
+	ch := newClientHandler()
+	c, err := client.Dial("tcp", addr, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_ = c.Write(99, nil)
+	_ = c.Write(apiChat, []byte("{not json"))
+	_ = c.Write(apiChat, []byte(`{"text":"hi"}`))
+	select {
+	case got := <-ch.recv:
+		if string(got) != `{"text":"echo: hi"}` {
+			t.Fatalf("reply %s", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no reply")
+	}
+	for i, want := range []uint16{99, apiChat} {
+		select {
+		case e := <-h.errs:
+			if e.api != want || e.err == nil {
+				t.Fatalf("error %d: api %d err %v, want api %d", i, e.api, e.err, want)
+			}
+			if want == 99 && !errors.Is(e.err, protocol.ErrUnknownApi) {
+				t.Fatalf("unknown api: err=%v", e.err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("error %d not reported", i)
+		}
+	}
+}
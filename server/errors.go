@@ -0,0 +1,54 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/legamerdc/gio/internal/handshake"
+	"github.com/legamerdc/gio/protocol"
+)
+
+var (
+	// ErrRxOverflow 表示单帧长度超出连接读环形缓冲（Config.RxRingSize）的容量。
+	ErrRxOverflow = errors.New("server: frame exceeds rx ring size")
+	// ErrBackpressure 表示连接发送队列超过高水位（Config.TxHighWatermark）。
+	ErrBackpressure = errors.New("server: tx queue above high watermark")
+	// ErrServerShutdown 表示连接在 Server.Stop 的等待期结束后被强制关闭。
+	ErrServerShutdown = errors.New("server: shutdown")
+	// ErrKicked 是 Server.Kick 未给出原因时 OnClose 收到的错误。
+	ErrKicked = errors.New("server: connection kicked")
+	// ErrIdleTimeout 表示连接在 Config.IdleTimeout 内未收到任何数据。
+	ErrIdleTimeout = errors.New("server: idle timeout")
+	// ErrHandshakeFailed 表示连接握手失败（消息非法、密钥确认失败或握手前收到业务消息），
+	// 具体原因包装在其中，可用 errors.Is 判断。
+	ErrHandshakeFailed = errors.New("server: handshake failed")
+	// 握手失败的具体原因，包装在 ErrHandshakeFailed 中：握手消息非法、版本不受支持、
+	// 客户端密钥确认失败、收到当前阶段不应出现的握手消息。
+	ErrHandshakeMalformed  = handshake.ErrMalformed
+	ErrHandshakeVersion    = handshake.ErrVersion
+	ErrHandshakeBadMAC     = handshake.ErrBadMAC
+	ErrHandshakeUnexpected = handshake.ErrUnexpected
+	// ErrNoKeyInstaller 表示启用 Config.Handshake 与 NewCipher 时 Cipher 未实现 KeyInstaller，
+	// 握手派生的秘密无处装入。
+	ErrNoKeyInstaller = errors.New("server: handshake requires a Cipher implementing KeyInstaller")
+	// ErrTLSInputOverflow 表示 TLS 握手期间对端发来的密文超过 shim 的缓冲上限（约一条最大记录）。
+	ErrTLSInputOverflow = errors.New("server: tls handshake input exceeds buffer limit")
+	// ErrHandshakeTimeout 表示连接未在 Config.HandshakeTimeout 内完成握手。
+	ErrHandshakeTimeout = errors.New("server: handshake timeout")
+	// ErrAuthFailed 表示认证帧校验失败（被篡改、重放或乱序），见 Config.FrameAEAD。
+	ErrAuthFailed = protocol.ErrAuthFailed
+	// 违反 Config 中接收上限的连接以下列错误关闭（见 protocol.Limits）。
+	ErrFrameTooLarge        = protocol.ErrFrameTooLarge
+	ErrDecompressedTooLarge = protocol.ErrDecompressedTooLarge
+	ErrBatchTooLarge        = protocol.ErrBatchTooLarge
+	ErrMessageTooLarge      = protocol.ErrMessageTooLarge
+	// ErrConnClosed 表示向已关闭的连接写入。
+	ErrConnClosed = errors.New("server: connection closed")
+	// ErrReservedApi 表示业务试图以保留的控制帧 api 发送消息。
+	ErrReservedApi = protocol.ErrReservedApi
+	// ErrInvalidWriteOption 表示互斥的写选项（Compressed 与 AlreadyMerged）被同时给出。
+	ErrInvalidWriteOption = errors.New("server: Compressed and AlreadyMerged are mutually exclusive")
+	// ErrHandlerPanic 表示 Recover 中间件捕获到处理函数 panic 后关闭连接。
+	ErrHandlerPanic = errors.New("server: handler panic")
+	// ErrUnauthorized 表示未认证的连接发送了非公开 api 的消息，见 RequireAuth。
+	ErrUnauthorized = errors.New("server: unauthorized")
+)
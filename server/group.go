@@ -0,0 +1,108 @@
+package server
+
+import "github.com/legamerdc/gio/protocol"
+
+// 主题订阅（房间/频道）：成员表按 poller 分片，只在所属 poller goroutine 中读写，
+// 订阅、退订与发布都经任务队列路由到对应分片，发布无需全局锁。
+
+// Subscribe 将连接加入 topic，可从任意 goroutine 调用；连接关闭时自动退订。
+func (s *Server[C]) Subscribe(c *Conn[C], topic string) {
+	rc := c.runtime
+	if rc == nil {
+		return
+	}
+	rc.sh.post(func() { rc.sh.subscribe(rc, topic) })
+}
+
+// Unsubscribe 将连接移出 topic，可从任意 goroutine 调用。
+func (s *Server[C]) Unsubscribe(c *Conn[C], topic string) {
+	rc := c.runtime
+	if rc == nil {
+		return
+	}
+	rc.sh.post(func() { rc.sh.unsubscribe(rc, topic) })
+}
+
+// Publish 向 topic 的全部成员发送消息：负载只编码（及按 Compress 压缩）一次，
+// 以 SharedPayload 扇出到各 poller，由各分片在自己的 goroutine 中入队。
+// Publish 在投递后即返回，不等待各分片完成；opts 含 Delayed 或启用了 Config.NewCipher 时逐成员编码。
+func (s *Server[C]) Publish(topic string, api uint16, msg []byte, opts ...WriteOption) error {
+	o, err := resolveWriteOpts(opts)
+	if err != nil {
+		return err
+	}
+	if protocol.IsControl(api) {
+		return ErrReservedApi
+	}
+	if o.delayed || s.ciphered() {
+		// 分片异步执行，先拷贝一份以免调用方复用 msg
+		cp := append([]byte(nil), msg...)
+		for _, sh := range s.shards {
+			sh.post(func() {
+				sh.eachMember(topic, func(c *connection[C]) { _ = c.write(cp, api, o) })
+			})
+		}
+		return nil
+	}
+	p, err := encodeShared(api, msg, o, s.comp)
+	if err != nil {
+		return err
+	}
+	for _, sh := range s.shards {
+		p.retain()
+		sh.post(func() {
+			defer p.Release()
+			sh.eachMember(topic, func(c *connection[C]) { _ = c.writeShared(p) })
+		})
+	}
+	p.Release()
+	return nil
+}
+
+func (s *srvShard[C]) subscribe(c *connection[C], topic string) {
+	if c.closed {
+		return
+	}
+	if _, ok := c.topics[topic]; ok {
+		return
+	}
+	if c.topics == nil {
+		c.topics = make(map[string]struct{})
+	}
+	c.topics[topic] = struct{}{}
+	if s.topics == nil {
+		s.topics = make(map[string]map[*connection[C]]struct{})
+	}
+	m := s.topics[topic]
+	if m == nil {
+		m = make(map[*connection[C]]struct{})
+		s.topics[topic] = m
+	}
+	m[c] = struct{}{}
+}
+
+func (s *srvShard[C]) unsubscribe(c *connection[C], topic string) {
+	if _, ok := c.topics[topic]; !ok {
+		return
+	}
+	delete(c.topics, topic)
+	if m := s.topics[topic]; m != nil {
+		delete(m, c)
+		if len(m) == 0 {
+			delete(s.topics, topic)
+		}
+	}
+}
+
+// unsubscribeAll 在连接关闭时退订其全部主题。
+func (s *srvShard[C]) unsubscribeAll(c *connection[C]) {
+	for topic := range c.topics {
+		s.unsubscribe(c, topic)
+	}
+}
+
+func (s *srvShard[C]) eachMember(topic string, fn func(c *connection[C])) {
+	for c := range s.topics[topic] {
+		fn(c)
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/legamerdc/gio/internal/handshake"
+	"github.com/legamerdc/gio/protocol"
+)
+
+// 连接建立握手（Config.Handshake）：accept 后等待客户端以 ApiHandshake 控制帧发起
+// X25519 密钥交换，完成后将派生的连接秘密装入 Cipher（协商了帧认证时同时启用 AEAD），
+// 才登记到连接注册表并回调 OnOpen。
+// 握手期间收到业务消息、校验失败或超时都会关闭连接；此时 OnClose 会在没有 OnOpen 的情况下回调。
+
+// open 在连接加入 poller 后调用：启用 TLS 或握手时登记超时定时器，否则立即就绪。
+func (c *connection[C]) open() {
+	if c.tls != nil {
+		c.startTLS()
+	}
+	if c.hsPending || c.tlsPending {
+		c.sh.afterFunc(c.srv.cfg.HandshakeTimeout, c.handshakeDue)
+		return
+	}
+	c.ready()
+}
+
+// ready 使连接对业务可见：登记到 ID 注册表、启动心跳并回调 OnOpen。
+func (c *connection[C]) ready() {
+	c.srv.ids.Store(c.api.ID, c)
+	c.startLiveness()
+	go c.srv.h.OnOpen(&c.api)
+}
+
+func (c *connection[C]) handshakeDue() {
+	if !c.closed && (c.hsPending || c.tlsPending) {
+		c.onClose(ErrHandshakeTimeout)
+	}
+}
+
+// onHandshake 在 poller goroutine 中处理客户端的握手消息。
+func (c *connection[C]) onHandshake(msg []byte) {
+	if !c.hsPending {
+		return
+	}
+	if c.hs == nil {
+		hs, reply, err := handshake.NewServer(handshake.ServerParams{
+			Static:            c.srv.cfg.HandshakeKey,
+			AEAD:              c.srv.cfg.FrameAEAD,
+			SelectCompression: c.srv.selectCompression,
+			SelectContext:     c.srv.selectContext,
+		}, msg)
+		if err != nil {
+			c.handshakeFailed(err)
+			return
+		}
+		c.hs = hs
+		if err := c.writeControl(protocol.ApiHandshake, reply); err != nil {
+			c.handshakeFailed(err)
+		}
+		return
+	}
+	res, err := c.hs.HandleFinished(msg)
+	if err != nil {
+		c.handshakeFailed(err)
+		return
+	}
+	if c.srv.ciphered() {
+		// C 为接口类型时 Start 无法静态判定，由具体实例决定
+		ki, ok := any(c.api.Data).(KeyInstaller)
+		if !ok {
+			c.handshakeFailed(ErrNoKeyInstaller)
+			return
+		}
+		if err := ki.InstallKeys(res.Secret, res.Salt); err != nil {
+			c.handshakeFailed(err)
+			return
+		}
+	}
+	if res.AEAD {
+		tx, rx, err := res.FrameAEADs(true)
+		if err != nil {
+			c.handshakeFailed(err)
+			return
+		}
+		// 客户端发出 Finished 之后的帧均已密封
+		c.prs.SetAEAD(rx)
+		c.agg.mu.Lock()
+		c.txAEAD = tx
+		c.agg.mu.Unlock()
+	}
+	if res.Compression != "" {
+		// 选定的算法必已注册（见 selectCompression）
+		comp, err := protocol.LookupCompressor(res.Compression)
+		if err != nil {
+			c.handshakeFailed(err)
+			return
+		}
+		c.prs.SetCompressor(comp)
+		c.agg.mu.Lock()
+		c.enc.SetCompressor(comp)
+		c.agg.mu.Unlock()
+	}
+	if res.ContextWindow > 0 {
+		c.setContext(res.ContextWindow)
+	}
+	c.hs, c.hsPending = nil, false
+	c.ready()
+}
+
+// selectCompression 接受客户端提议的、位于 Config.CompressionAllowed 中的算法，
+// 否则（含未提议）使用 Config.CompressionAlgo。
+func (s *Server[C]) selectCompression(offer string) string {
+	if offer != "" && slices.Contains(s.cfg.CompressionAllowed, offer) {
+		if _, err := protocol.LookupCompressor(offer); err == nil {
+			return offer
+		}
+	}
+	return s.comp.Name()
+}
+
+// selectContext 取客户端提议与 Config.ContextTakeover 中较小的窗口，0 表示不启用。
+func (s *Server[C]) selectContext(offer int) int { return max(min(offer, s.cfg.ContextTakeover), 0) }
+
+// setContext 为本连接的两个方向启用上下文接管。
+func (c *connection[C]) setContext(window int) {
+	c.prs.SetContext(window)
+	c.agg.mu.Lock()
+	c.enc.SetContext(window)
+	c.agg.mu.Unlock()
+}
+
+// checkContextLocked 在上下文状态（两个方向合计）超过 Config.ContextMemoryLimit 时回退为无状态压缩。
+// 须在上下文帧入队之后调用，ApiContextReset 才会排在本端最后一个上下文帧之后。调用方持有 agg.mu。
+func (c *connection[C]) checkContextLocked() {
+	lim := c.srv.cfg.ContextMemoryLimit
+	if lim > 0 && !c.ctxReset && c.enc.ContextMemory()+int(c.rxCtxMem.Load()) > lim {
+		c.resetContextLocked()
+	}
+}
+
+// resetContextLocked 停止发送上下文帧、释放流式编码状态并通知对端，至多一次。调用方持有 agg.mu。
+func (c *connection[C]) resetContextLocked() {
+	if c.ctxReset {
+		return
+	}
+	c.ctxReset = true
+	c.enc.ResetContext()
+	_ = c.writeControlLocked(protocol.ApiContextReset, nil)
+}
+
+// noteRxContext 在解析之后发布接收方向上下文状态的占用，增长时检查上限；在 poller goroutine 中调用。
+func (c *connection[C]) noteRxContext() {
+	if c.srv.cfg.ContextMemoryLimit <= 0 {
+		return
+	}
+	m := int64(c.prs.ContextMemory())
+	if m == c.rxCtxMem.Load() {
+		return
+	}
+	c.rxCtxMem.Store(m)
+	c.agg.mu.Lock()
+	c.checkContextLocked()
+	c.agg.mu.Unlock()
+}
+
+// onContextReset 处理对端的 ApiContextReset：对端不再发送上下文帧，释放解码状态，本端同样回退。
+func (c *connection[C]) onContextReset() {
+	c.prs.ResetContext()
+	c.rxCtxMem.Store(0)
+	c.agg.mu.Lock()
+	c.resetContextLocked()
+	c.agg.mu.Unlock()
+}
+
+func (c *connection[C]) handshakeFailed(err error) {
+	c.onClose(fmt.Errorf("%w: %w", ErrHandshakeFailed, err))
+}
+
+// installsKeys 报告 C 是否实现 KeyInstaller；C 为接口类型时无法静态判定，按实现处理。
+func installsKeys[C Cipher]() bool {
+	t := reflect.TypeFor[C]()
+	return t.Kind() == reflect.Interface || t.Implements(reflect.TypeFor[KeyInstaller]())
+}
@@ -0,0 +1,100 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/legamerdc/gio/client"
+	"github.com/legamerdc/gio/protocol"
+	"github.com/legamerdc/gio/server"
+)
+
+// closeErrHandler 将 OnClose 收到的错误送入 closed。
+type closeErrHandler struct{ closed chan error }
+
+func (closeErrHandler) OnOpen(c *server.Conn[nopCipher]) {}
+
+func (closeErrHandler) OnMessage(c *server.Conn[nopCipher], api uint16, msg []byte) bool {
+	return false
+}
+
+// OnClose 在 closed 已满时丢弃错误，不阻塞 poller。
+func (h closeErrHandler) OnClose(c *server.Conn[nopCipher], err error) {
+	select {
+	case h.closed <- err:
+	default:
+	}
+}
+
+func startHandshake(t *testing.T, key *ecdh.PrivateKey) (string, closeErrHandler) {
+	t.Helper()
+	addr := freeAddr(t)
+	h := closeErrHandler{closed: make(chan error, 1)}
+	srv, err := server.Start[nopCipher](server.Config[nopCipher]{
+		ListenNetwork: "tcp",
+		ListenAddress: addr,
+		Handshake:     true,
+		HandshakeKey:  key,
+	}, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Stop(context.Background()) })
+	return addr, h
+}
+
+// TestHandshakeErrors 校验非法的握手消息以包装了具体原因的 ErrHandshakeFailed 关闭连接。
+func TestHandshakeErrors(t *testing.T) {
+	addr, h := startHandshake(t, nil)
+	enc, _ := protocol.NewEncoder()
+	for _, tc := range []struct {
+		name  string
+		hello []byte
+		want  error
+	}{
+		{"unexpected", []byte{0xff, 1}, server.ErrHandshakeUnexpected},
+		{"version", []byte{1, 0xff}, server.ErrHandshakeVersion},
+		{"malformed", []byte{1, 1, 0}, server.ErrHandshakeMalformed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nc, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer nc.Close()
+			f, _ := enc.EncodeSingle(protocol.ApiHandshake, tc.hello, false)
+			if _, err := nc.Write(f); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case err := <-h.closed:
+				if !errors.Is(err, server.ErrHandshakeFailed) || !errors.Is(err, tc.want) {
+					t.Fatalf("OnClose err = %v, want ErrHandshakeFailed wrapping %v", err, tc.want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("connection not closed")
+			}
+		})
+	}
+}
+
+// TestHandshakeServerKeyMismatch 校验客户端固定的服务端公钥不符时 Dial 返回可用 errors.Is 判断的具体原因。
+func TestHandshakeServerKeyMismatch(t *testing.T) {
+	key, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	other, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	addr, _ := startHandshake(t, key)
+	_, err := client.DialConfig("tcp", addr, client.Config{Handshake: true, ServerKey: other.PublicKey()}, newClientHandler())
+	if !errors.Is(err, client.ErrHandshakeFailed) || !errors.Is(err, client.ErrServerKey) {
+		t.Fatalf("Dial err = %v, want ErrHandshakeFailed wrapping ErrServerKey", err)
+	}
+	c, err := client.DialConfig("tcp", addr, client.Config{Handshake: true, ServerKey: key.PublicKey()}, newClientHandler())
+	if err != nil {
+		t.Fatalf("Dial with the right key: %v", err)
+	}
+	c.Close()
+}
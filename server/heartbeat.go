@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/legamerdc/gio/protocol"
+)
+
+// 心跳与空闲检测（Config.HeartbeatInterval / Config.IdleTimeout）：
+// 两者均为 per-connection 的时间轮定时器，在所属 poller goroutine 中触发，
+// 不额外创建 goroutine 或 time.Timer。
+
+// startLiveness 在连接建立后登记心跳与空闲定时器。
+func (c *connection[C]) startLiveness() {
+	cfg := &c.srv.cfg
+	if cfg.IdleTimeout > 0 {
+		c.sh.afterFunc(cfg.IdleTimeout, c.checkIdle)
+	}
+	if cfg.HeartbeatInterval > 0 {
+		c.sh.afterFunc(cfg.HeartbeatInterval, c.heartbeat)
+	}
+}
+
+// checkIdle 在最后一次收到数据后满 IdleTimeout 时以 ErrIdleTimeout 关闭连接，
+// 否则按剩余时长重新登记。
+func (c *connection[C]) checkIdle() {
+	if c.closed {
+		return
+	}
+	timeout := c.srv.cfg.IdleTimeout
+	idle := time.Since(c.lastRx)
+	if idle >= timeout {
+		c.goAway(ErrIdleTimeout.Error())
+		c.closeAfterFlush(ErrIdleTimeout)
+		return
+	}
+	c.sh.afterFunc(timeout-idle, c.checkIdle)
+}
+
+// heartbeat 发送携带发送时刻的 ping，对端回 pong 后据此更新 RTT。
+func (c *connection[C]) heartbeat() {
+	if c.closed {
+		return
+	}
+	var ts [protocol.PingPayloadLen]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Since(c.srv.epoch)))
+	if err := c.writeControl(protocol.ApiPing, ts[:]); err != nil {
+		return
+	}
+	c.sh.afterFunc(c.srv.cfg.HeartbeatInterval, c.heartbeat)
+}
+
+// onControl 处理对端发来的控制帧；在 poller goroutine 中调用，payload 仅在调用期间有效。
+// 未定义的控制 api 返回 protocol.ErrUnknownControl，连接随之关闭。
+func (c *connection[C]) onControl(api uint16, payload []byte) error {
+	switch api {
+	case protocol.ApiPing:
+		_ = c.writeControl(protocol.ApiPong, payload)
+	case protocol.ApiHandshake:
+		c.onHandshake(payload)
+	case protocol.ApiPong:
+		if len(payload) != protocol.PingPayloadLen {
+			return nil
+		}
+		sent := time.Duration(binary.BigEndian.Uint64(payload))
+		c.rtt.Update(time.Since(c.srv.epoch) - sent)
+	case protocol.ApiContextReset:
+		c.onContextReset()
+	case protocol.ApiGoAway:
+		// 对端即将关闭，等待其断开
+	default:
+		return fmt.Errorf("%w: %#x", protocol.ErrUnknownControl, api)
+	}
+	return nil
+}
+
+// writeControl 立即排队一个控制帧；与业务写入经 agg.mu 串行。
+func (c *connection[C]) writeControl(api uint16, payload []byte) error {
+	a := c.agg
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return c.writeControlLocked(api, payload)
+}
+
+func (c *connection[C]) writeControlLocked(api uint16, payload []byte) error {
+	f := txFrame{api: api, msg: payload}
+	return c.enqueueFrame(&f)
+}
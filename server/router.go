@@ -0,0 +1,249 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HandlerFunc 处理一条消息，调用约定与返回值同 Handler.OnMessage。
+type HandlerFunc[C Cipher] func(c *Conn[C], api uint16, msg []byte) (async bool)
+
+// Middleware 包装 HandlerFunc，可在调用 next 前后插入逻辑或不调用 next 以拦截消息。
+type Middleware[C Cipher] func(next HandlerFunc[C]) HandlerFunc[C]
+
+type apiRange[C Cipher] struct {
+	lo, hi uint16
+	h      HandlerFunc[C]
+}
+
+// Router 按 api 将消息路由到登记的 HandlerFunc，实现 Handler 与 DrainHandler。
+// 精确登记的 api 优先，其次按登记顺序匹配 api 段，都未命中时交给 NotFound 登记的兜底函数
+// （缺省记录日志并丢弃）。全局中间件（Use）包装所有路由与兜底，先登记的在外层；
+// 路由自身的中间件位于全局中间件之内。登记须在 Server.Start 之前完成，首条消息到达时链即固定。
+type Router[C Cipher] struct {
+	// 连接建立、关闭与发送队列回落时的回调，均可为 nil
+	Opened  func(c *Conn[C])
+	Closed  func(c *Conn[C], err error)
+	Drained func(c *Conn[C])
+
+	mw       []Middleware[C]
+	routes   map[uint16]HandlerFunc[C]
+	ranges   []apiRange[C]
+	fallback HandlerFunc[C]
+
+	once sync.Once
+	// 组合中间件后的路由表，首次分发时构建
+	chain    map[uint16]HandlerFunc[C]
+	rchain   []apiRange[C]
+	notFound HandlerFunc[C]
+}
+
+func NewRouter[C Cipher]() *Router[C] {
+	return &Router[C]{routes: make(map[uint16]HandlerFunc[C])}
+}
+
+// Use 追加全局中间件。
+func (r *Router[C]) Use(mw ...Middleware[C]) { r.mw = append(r.mw, mw...) }
+
+// Handle 将 api 路由到 h，mw 仅作用于该路由；重复登记时覆盖。
+func (r *Router[C]) Handle(api uint16, h HandlerFunc[C], mw ...Middleware[C]) {
+	r.routes[api] = wrap(h, mw)
+}
+
+// HandleRange 将 [lo, hi] 段内的 api 路由到 h，mw 仅作用于该路由。
+func (r *Router[C]) HandleRange(lo, hi uint16, h HandlerFunc[C], mw ...Middleware[C]) {
+	if lo > hi {
+		panic(fmt.Sprintf("server: invalid api range [%d, %d]", lo, hi))
+	}
+	r.ranges = append(r.ranges, apiRange[C]{lo: lo, hi: hi, h: wrap(h, mw)})
+}
+
+// NotFound 设置未命中任何路由时的兜底函数。
+func (r *Router[C]) NotFound(h HandlerFunc[C]) { r.fallback = h }
+
+// wrap 以 mw 包装 h，mw[0] 在最外层。
+func wrap[C Cipher](h HandlerFunc[C], mw []Middleware[C]) HandlerFunc[C] {
+	for _, m := range slices.Backward(mw) {
+		h = m(h)
+	}
+	return h
+}
+
+func (r *Router[C]) build() {
+	r.chain = make(map[uint16]HandlerFunc[C], len(r.routes))
+	for api, h := range r.routes {
+		r.chain[api] = wrap(h, r.mw)
+	}
+	r.rchain = make([]apiRange[C], len(r.ranges))
+	for i, rg := range r.ranges {
+		r.rchain[i] = apiRange[C]{lo: rg.lo, hi: rg.hi, h: wrap(rg.h, r.mw)}
+	}
+	fb := r.fallback
+	if fb == nil {
+		fb = func(c *Conn[C], api uint16, msg []byte) bool {
+			log.Printf("server: no route for api %d", api)
+			return false
+		}
+	}
+	r.notFound = wrap(fb, r.mw)
+}
+
+// lookup 返回 api 的处理链。
+func (r *Router[C]) lookup(api uint16) HandlerFunc[C] {
+	r.once.Do(r.build)
+	if h, ok := r.chain[api]; ok {
+		return h
+	}
+	for _, rg := range r.rchain {
+		if api >= rg.lo && api <= rg.hi {
+			return rg.h
+		}
+	}
+	return r.notFound
+}
+
+func (r *Router[C]) OnOpen(c *Conn[C]) {
+	if r.Opened != nil {
+		r.Opened(c)
+	}
+}
+
+func (r *Router[C]) OnMessage(c *Conn[C], api uint16, msg []byte) bool {
+	return r.lookup(api)(c, api, msg)
+}
+
+func (r *Router[C]) OnClose(c *Conn[C], err error) {
+	if r.Closed != nil {
+		r.Closed(c, err)
+	}
+}
+
+func (r *Router[C]) OnDrain(c *Conn[C]) {
+	if r.Drained != nil {
+		r.Drained(c)
+	}
+}
+
+// Recover 捕获处理函数的 panic，以 ErrHandlerPanic 关闭该连接而不影响所在 poller 上的其他连接；
+// onPanic 非 nil 时先以 panic 值调用，缺省记录日志与调用栈。c.Go 中的任务运行在 worker 上，不受其保护。
+func Recover[C Cipher](onPanic func(c *Conn[C], api uint16, v any)) Middleware[C] {
+	return func(next HandlerFunc[C]) HandlerFunc[C] {
+		return func(c *Conn[C], api uint16, msg []byte) (async bool) {
+			defer func() {
+				if v := recover(); v != nil {
+					if onPanic != nil {
+						onPanic(c, api, v)
+					} else {
+						log.Printf("server: panic in handler api=%d conn=%d: %v\n%s", api, c.ID, v, debug.Stack())
+					}
+					c.closeWith(fmt.Errorf("%w: %v", ErrHandlerPanic, v))
+					async = false
+				}
+			}()
+			return next(c, api, msg)
+		}
+	}
+}
+
+// Logging 以 logf（缺省 log.Printf）记录每条消息的 api、长度、同步处理耗时及是否转入异步。
+func Logging[C Cipher](logf func(format string, args ...any)) Middleware[C] {
+	if logf == nil {
+		logf = log.Printf
+	}
+	return func(next HandlerFunc[C]) HandlerFunc[C] {
+		return func(c *Conn[C], api uint16, msg []byte) bool {
+			start := time.Now()
+			async := next(c, api, msg)
+			logf("server: conn=%d api=%d len=%d took=%v async=%v", c.ID, api, len(msg), time.Since(start), async)
+			return async
+		}
+	}
+}
+
+// RequireAuth 拦截 authed 返回 false 的连接上 public 之外的 api，以 ErrUnauthorized 关闭连接；
+// 登录等认证前须可用的 api 列入 public。authed 在 poller goroutine 中调用，通常读取 c.Data 中的状态。
+func RequireAuth[C Cipher](authed func(c *Conn[C]) bool, public ...uint16) Middleware[C] {
+	return func(next HandlerFunc[C]) HandlerFunc[C] {
+		return func(c *Conn[C], api uint16, msg []byte) bool {
+			if !authed(c) && !slices.Contains(public, api) {
+				c.closeWith(fmt.Errorf("%w: api %d", ErrUnauthorized, api))
+				return false
+			}
+			return next(c, api, msg)
+		}
+	}
+}
+
+// Metrics 记录每个 api 经 next 的同步处理耗时（不含 c.Go 中的异步部分），
+// 可从任意 goroutine 读取；零值可用。
+type Metrics struct {
+	stats sync.Map // uint16 -> *apiStat
+}
+
+type apiStat struct {
+	count, total, max atomic.Int64
+}
+
+// ApiStat 为单个 api 的统计快照。
+type ApiStat struct {
+	Count int64
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Mean 返回平均耗时。
+func (s ApiStat) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// Observe 记录 api 的一次耗时。
+func (m *Metrics) Observe(api uint16, d time.Duration) {
+	v, ok := m.stats.Load(api)
+	if !ok {
+		v, _ = m.stats.LoadOrStore(api, new(apiStat))
+	}
+	st := v.(*apiStat)
+	st.count.Add(1)
+	st.total.Add(int64(d))
+	for {
+		cur := st.max.Load()
+		if int64(d) <= cur || st.max.CompareAndSwap(cur, int64(d)) {
+			break
+		}
+	}
+}
+
+// Snapshot 返回各 api 当前的统计。
+func (m *Metrics) Snapshot() map[uint16]ApiStat {
+	out := make(map[uint16]ApiStat)
+	m.stats.Range(func(k, v any) bool {
+		st := v.(*apiStat)
+		out[k.(uint16)] = ApiStat{
+			Count: st.count.Load(),
+			Total: time.Duration(st.total.Load()),
+			Max:   time.Duration(st.max.Load()),
+		}
+		return true
+	})
+	return out
+}
+
+// Latency 将每条消息的同步处理耗时交给 observe（如 (*Metrics).Observe 或外部监控的直方图）。
+func Latency[C Cipher](observe func(api uint16, d time.Duration)) Middleware[C] {
+	return func(next HandlerFunc[C]) HandlerFunc[C] {
+		return func(c *Conn[C], api uint16, msg []byte) bool {
+			start := time.Now()
+			async := next(c, api, msg)
+			observe(api, time.Since(start))
+			return async
+		}
+	}
+}
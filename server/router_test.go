@@ -0,0 +1,209 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/legamerdc/gio/protocol"
+	"github.com/legamerdc/gio/server"
+)
+
+// tagged 返回在 next 前后记录 name 的中间件。
+func tagged(trace *[]string, name string) server.Middleware[nopCipher] {
+	return func(next server.HandlerFunc[nopCipher]) server.HandlerFunc[nopCipher] {
+		return func(c *server.Conn[nopCipher], api uint16, msg []byte) bool {
+			*trace = append(*trace, name)
+			async := next(c, api, msg)
+			*trace = append(*trace, "/"+name)
+			return async
+		}
+	}
+}
+
+// TestRouterMiddlewareOrder 校验全局中间件按登记顺序由外到内、路由中间件位于其内，
+// 兜底函数同样经过全局中间件，且处理函数的返回值原样传出。
+func TestRouterMiddlewareOrder(t *testing.T) {
+	var trace []string
+	handler := func(name string, async bool) server.HandlerFunc[nopCipher] {
+		return func(c *server.Conn[nopCipher], api uint16, msg []byte) bool {
+			trace = append(trace, name)
+			return async
+		}
+	}
+	r := server.NewRouter[nopCipher]()
+	r.Use(tagged(&trace, "g1"), tagged(&trace, "g2"))
+	r.Handle(1, handler("h1", true), tagged(&trace, "r1"), tagged(&trace, "r2"))
+	r.HandleRange(100, 199, handler("range", false), tagged(&trace, "rr"))
+	r.NotFound(handler("fallback", false))
+
+	for _, tc := range []struct {
+		api   uint16
+		async bool
+		want  string
+	}{
+		{1, true, "g1 g2 r1 r2 h1 /r2 /r1 /g2 /g1"},
+		{150, false, "g1 g2 rr range /rr /g2 /g1"},
+		{7, false, "g1 g2 fallback /g2 /g1"},
+	} {
+		trace = trace[:0]
+		if async := r.OnMessage(nil, tc.api, nil); async != tc.async {
+			t.Errorf("api %d: async=%v, want %v", tc.api, async, tc.async)
+		}
+		if got := strings.Join(trace, " "); got != tc.want {
+			t.Errorf("api %d: %s, want %s", tc.api, got, tc.want)
+		}
+	}
+}
+
+// TestRouterRanges 校验精确登记优先于 api 段、重叠的段按登记顺序先登记者命中、重复的精确登记覆盖，
+// 以及段边界与非法段。
+func TestRouterRanges(t *testing.T) {
+	var got string
+	route := func(name string) server.HandlerFunc[nopCipher] {
+		return func(c *server.Conn[nopCipher], api uint16, msg []byte) bool {
+			got = name
+			return false
+		}
+	}
+	r := server.NewRouter[nopCipher]()
+	r.HandleRange(100, 199, route("wide"))
+	r.HandleRange(150, 159, route("narrow"))
+	r.HandleRange(190, 250, route("tail"))
+	r.Handle(155, route("old"))
+	r.Handle(155, route("exact"))
+	r.NotFound(route("fallback"))
+	for api, want := range map[uint16]string{
+		99: "fallback", 100: "wide", 150: "wide", 155: "exact", 199: "wide", 200: "tail", 250: "tail", 251: "fallback",
+	} {
+		got = ""
+		r.OnMessage(nil, api, nil)
+		if got != want {
+			t.Errorf("api %d routed to %q, want %q", api, got, want)
+		}
+	}
+	mustPanic(t, "HandleRange(2, 1)", func() { r.HandleRange(2, 1, route("bad")) })
+}
+
+// startRouter 以 r 启动服务端并建立一个裸连接，返回按 api 写入单帧的函数与记录关闭原因的通道。
+func startRouter(t *testing.T, r *server.Router[nopCipher]) (func(apis ...uint16), <-chan error) {
+	t.Helper()
+	closed := make(chan error, 1)
+	r.Closed = func(c *server.Conn[nopCipher], err error) {
+		select {
+		case closed <- err:
+		default:
+		}
+	}
+	addr := freeAddr(t)
+	srv, err := server.Start[nopCipher](server.Config[nopCipher]{ListenNetwork: "tcp", ListenAddress: addr}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Stop(context.Background()) })
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	enc, _ := protocol.NewEncoder()
+	// 各帧在一次写入中到达，拦截后的帧已在同一读缓冲中
+	return func(apis ...uint16) {
+		var b []byte
+		for _, api := range apis {
+			b, _ = enc.AppendSingle(b, api, []byte{byte(api)}, 0)
+		}
+		if _, err := nc.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}, closed
+}
+
+func expectClosed(t *testing.T, closed <-chan error, want error) {
+	t.Helper()
+	select {
+	case err := <-closed:
+		if !errors.Is(err, want) {
+			t.Fatalf("OnClose err = %v, want %v", err, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection not closed")
+	}
+}
+
+// recordRoute 返回将消息送入 recv 的处理函数。
+func recordRoute(recv chan rxMsg) server.HandlerFunc[nopCipher] {
+	return func(c *server.Conn[nopCipher], api uint16, msg []byte) bool {
+		recv <- rxMsg{api, append([]byte(nil), msg...)}
+		return false
+	}
+}
+
+// TestRecoverCloses 校验 Recover 捕获 panic 后以 ErrHandlerPanic 关闭连接，同批到达的后续消息不再交付。
+func TestRecoverCloses(t *testing.T) {
+	recv := make(chan rxMsg, 8)
+	panics := make(chan any, 1)
+	r := server.NewRouter[nopCipher]()
+	r.Use(server.Recover(func(c *server.Conn[nopCipher], api uint16, v any) { panics <- v }))
+	r.Handle(2, func(c *server.Conn[nopCipher], api uint16, msg []byte) bool { panic("boom") })
+	r.NotFound(recordRoute(recv))
+	write, closed := startRouter(t, r)
+
+	write(1, 2, 3)
+	expectClosed(t, closed, server.ErrHandlerPanic)
+	if v := <-panics; v != "boom" {
+		t.Fatalf("onPanic got %v", v)
+	}
+	expectMsgs(t, recv, rxMsg{1, []byte{1}})
+}
+
+// TestRequireAuth 校验未认证连接的公开 api 照常交付，非公开 api 以 ErrUnauthorized 关闭连接且其后的消息不再交付；
+// 认证后的连接不受限制。
+func TestRequireAuth(t *testing.T) {
+	const apiLogin, apiSecret = 1, 2
+	for _, tc := range []struct {
+		name   string
+		apis   []uint16
+		want   []uint16
+		closed error
+	}{
+		{"unauthorized", []uint16{apiSecret, apiLogin, apiSecret}, nil, server.ErrUnauthorized},
+		{"authed", []uint16{apiLogin, apiSecret, 9}, []uint16{apiLogin, apiSecret, 9}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recv := make(chan rxMsg, 8)
+			var authed sync.Map // conn ID -> struct{}
+			r := server.NewRouter[nopCipher]()
+			r.Use(server.RequireAuth(func(c *server.Conn[nopCipher]) bool {
+				_, ok := authed.Load(c.ID)
+				return ok
+			}, apiLogin))
+			r.Handle(apiLogin, func(c *server.Conn[nopCipher], api uint16, msg []byte) bool {
+				authed.Store(c.ID, struct{}{})
+				return recordRoute(recv)(c, api, msg)
+			})
+			r.NotFound(recordRoute(recv))
+			write, closed := startRouter(t, r)
+			write(tc.apis...)
+			if tc.closed != nil {
+				expectClosed(t, closed, tc.closed)
+			}
+			var want []rxMsg
+			for _, api := range tc.want {
+				want = append(want, rxMsg{api, []byte{byte(api)}})
+			}
+			expectMsgs(t, recv, want...)
+			if tc.closed == nil {
+				select {
+				case err := <-closed:
+					t.Fatalf("authed connection closed: %v", err)
+				default:
+				}
+			}
+		})
+	}
+}
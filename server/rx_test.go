@@ -0,0 +1,107 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/legamerdc/gio/protocol"
+	"github.com/legamerdc/gio/server"
+)
+
+type rxMsg struct {
+	api uint16
+	msg []byte
+}
+
+// recvHandler 将收到的消息拷贝后送入 recv。
+type recvHandler struct{ recv chan rxMsg }
+
+func (recvHandler) OnOpen(c *server.Conn[nopCipher]) {}
+
+func (h recvHandler) OnMessage(c *server.Conn[nopCipher], api uint16, msg []byte) bool {
+	h.recv <- rxMsg{api, append([]byte(nil), msg...)}
+	return false
+}
+
+func (recvHandler) OnClose(c *server.Conn[nopCipher], err error) {}
+
+// expectMsgs 校验依次收到 want 中的消息，且其后没有多余的交付。
+func expectMsgs(t *testing.T, recv <-chan rxMsg, want ...rxMsg) {
+	t.Helper()
+	for i, w := range want {
+		select {
+		case m := <-recv:
+			if m.api != w.api || !bytes.Equal(m.msg, w.msg) {
+				t.Fatalf("msg %d: got api %d len %d, want api %d len %d", i, m.api, len(m.msg), w.api, len(w.msg))
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("msg %d: timeout", i)
+		}
+	}
+	select {
+	case m := <-recv:
+		t.Fatalf("unexpected extra delivery: api %d len %d", m.api, len(m.msg))
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestRxReassembly 校验跨多次读取到达的帧（逐字节、跨环回绕点分两段）恰好交付一次。
+func TestRxReassembly(t *testing.T) {
+	const ring = 1024
+	addr := freeAddr(t)
+	h := recvHandler{recv: make(chan rxMsg, 16)}
+	srv, err := server.Start[nopCipher](server.Config[nopCipher]{
+		ListenNetwork: "tcp",
+		ListenAddress: addr,
+		RxRingSize:    ring,
+	}, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop(context.Background())
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	enc, _ := protocol.NewEncoder()
+	frame := func(api uint16, n int) ([]byte, rxMsg) {
+		msg := bytes.Repeat([]byte{byte(api)}, n)
+		f, err := enc.EncodeSingle(api, msg, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f, rxMsg{api, msg}
+	}
+	write := func(b []byte) {
+		if _, err := nc.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 逐字节
+	f1, m1 := frame(1, 200)
+	for i := range f1 {
+		write(f1[i : i+1])
+	}
+	expectMsgs(t, h.recv, m1)
+
+	// 填充至距环尾 20 字节，下一帧的头部与负载跨越回绕点分两段到达
+	f2, m2 := frame(2, ring-20-len(f1)-4)
+	write(f2)
+	expectMsgs(t, h.recv, m2)
+	f3, m3 := frame(3, 100)
+	write(f3[:60])
+	write(f3[60:])
+	expectMsgs(t, h.recv, m3)
+
+	// 回绕之后的帧照常交付
+	f4, m4 := frame(4, 300)
+	write(f4[:1])
+	write(f4[1:])
+	expectMsgs(t, h.recv, m4)
+}
@@ -3,9 +3,12 @@ package server
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/legamerdc/gio/internal/bufpool"
 	"github.com/legamerdc/gio/poller"
+	"github.com/legamerdc/gio/protocol"
 )
 
 type Server[C Cipher] struct {
@@ -14,23 +17,46 @@ type Server[C Cipher] struct {
 	lfds []int
 	pls  []poller.Poller
 	wg   sync.WaitGroup
+	// 每个 poller 一个分片，承载跨 goroutine 任务投递等 per-poller 状态
+	shards []*srvShard[C]
 
 	conns sync.Map // fd -> *connection[C]
+	ids   sync.Map // Conn.ID -> *connection[C]
+	// 连接 ID 代数，服务器内单调递增
+	gen atomic.Uint64
 
-	tw *timerWheel
+	// Server.AfterFunc 轮转选择 poller
+	rr atomic.Uint32
+	// 存活连接数；Stop 开始后不再接受新连接
+	nconns   atomic.Int64
+	stopping atomic.Bool
+	// 首个 Stop 完成时关闭 stopDone，其结果记于 stopErr，之后的调用等待并返回同一结果
+	stopDone chan struct{}
+	stopErr  error
+	// 心跳时间戳的基准（单调时钟）
+	epoch time.Time
+	// Config.CompressionAlgo 对应的压缩算法，握手未另行协商时各连接均使用它
+	comp protocol.Compressor
 }
 
 func Start[C Cipher](cfg Config[C], h Handler[C]) (*Server[C], error) {
-	s := &Server[C]{cfg: cfg, h: h}
-	if cfg.NumPollers <= 0 {
-		cfg.NumPollers = 1
+	cfg.normalize()
+	comp, err := protocol.LookupCompressor(cfg.CompressionAlgo)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range cfg.CompressionAllowed {
+		if _, err := protocol.LookupCompressor(name); err != nil {
+			return nil, err
+		}
 	}
-	// 创建时间轮
-	tick := cfg.TimerWheelTick
-	if tick <= 0 {
-		tick = time.Millisecond
+	if cfg.ContextTakeover != 0 && !protocol.ValidContextWindow(cfg.ContextTakeover) {
+		return nil, protocol.ErrContextWindow
 	}
-	s.tw = newTimerWheel(tick)
+	if cfg.Handshake && cfg.NewCipher != nil && !installsKeys[C]() {
+		return nil, ErrNoKeyInstaller
+	}
+	s := &Server[C]{cfg: cfg, h: h, epoch: time.Now(), comp: comp, stopDone: make(chan struct{})}
 	// 创建多个监听 + 多个 poller
 	for i := 0; i < cfg.NumPollers; i++ {
 		lfd, err := openListener(cfg.ListenNetwork, cfg.ListenAddress, cfg.ReusePort)
@@ -46,14 +72,18 @@ func Start[C Cipher](cfg Config[C], h Handler[C]) (*Server[C], error) {
 		}
 		s.lfds = append(s.lfds, lfd)
 		s.pls = append(s.pls, p)
+		sh := &srvShard[C]{Server: s, idx: i, pool: bufpool.New(), tw: newTimerWheel(cfg.TimerWheelTick)}
+		s.shards = append(s.shards, sh)
 		_ = p.Register(lfd, true, false)
-		// 启动事件循环
-		pl := p
+	}
+	// 全部分片就绪后再启动事件循环，避免与上面的切片追加并发
+	for i, sh := range s.shards {
+		pl := s.pls[i]
 		idx := i
 		s.wg.Add(1)
 		go func() {
 			defer s.wg.Done()
-			_ = pl.Run((*srvHandler[C])(&srvShard[C]{Server: s, idx: idx}))
+			_ = pl.Run((*srvHandler[C])(sh))
 		}()
 		// 启动备用 accept 轮询
 		s.wg.Add(1)
@@ -62,31 +92,150 @@ func Start[C Cipher](cfg Config[C], h Handler[C]) (*Server[C], error) {
 			startAcceptorShard(s, idx)
 		}()
 	}
-	// 启动时间轮（目前仅占位）
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
-		s.tw.run(func() {
-			// 将来触发各连接的 TxAggregator 刷新
-		})
-	}()
 	return s, nil
 }
 
+// Stop 优雅关闭服务器：
+//  1. 停止接受新连接；
+//  2. 向每个连接发送 GOAWAY 控制帧，并刷出暂存与排队的写入；
+//  3. 等待客户端自行断开，直到 ctx 截止；
+//  4. 强制关闭剩余连接，其 OnClose 收到 ErrServerShutdown。
+//
+// 全部连接在截止前离开时返回 nil，否则返回 ctx.Err()。重复或并发的调用等待首个调用完成
+// 并返回其结果，自身的 ctx 先截止时返回 ctx.Err()。
 func (s *Server[C]) Stop(ctx context.Context) error {
-	for _, p := range s.pls {
-		p.Close()
+	if s.stopping.Swap(true) {
+		select {
+		case <-s.stopDone:
+			return s.stopErr
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
-	for _, fd := range s.lfds {
-		_ = closeFD(fd)
+	defer close(s.stopDone)
+	for _, sh := range s.shards {
+		sh.post(sh.stopAccept)
+		sh.post(func() {
+			sh.eachConn(func(c *connection[C]) { c.goAway("shutdown") })
+		})
+	}
+	var err error
+	if s.nconns.Load() > 0 {
+		tk := time.NewTicker(10 * time.Millisecond)
+	wait:
+		for s.nconns.Load() > 0 {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+				break wait
+			case <-tk.C:
+			}
+		}
+		tk.Stop()
 	}
-	if s.tw != nil {
-		s.tw.stop()
+	// 在各 poller goroutine 中强制关闭剩余连接，完成后再退出事件循环
+	var done sync.WaitGroup
+	for _, sh := range s.shards {
+		done.Add(1)
+		sh.post(func() {
+			defer done.Done()
+			sh.eachConn(func(c *connection[C]) { c.onClose(ErrServerShutdown) })
+		})
+	}
+	done.Wait()
+	for _, p := range s.pls {
+		p.Close()
 	}
 	s.wg.Wait()
+	s.stopErr = err
+	return err
+}
+
+// AfterFunc 在 d 之后于某个 poller goroutine 中执行 fn（按 poller 轮转），
+// 返回可取消的句柄；可从任意 goroutine 调用。
+func (s *Server[C]) AfterFunc(d time.Duration, fn func()) *Timer {
+	i := s.rr.Add(1) % uint32(len(s.shards))
+	return s.shards[i].afterFunc(d, fn)
+}
+
+// 连接 ID 布局：低 connIDShardBits 位为所属 poller 下标（路由标签），
+// 高位为服务器内单调递增的代数，因此 ID 永不复用（不同于 fd）。
+const (
+	connIDShardBits = 16
+	connIDShardMask = 1<<connIDShardBits - 1
+)
+
+func (s *Server[C]) nextConnID(idx int) uint64 {
+	return s.gen.Add(1)<<connIDShardBits | uint64(idx)
+}
+
+// Conn 按 ID 查找存活连接，不存在或已关闭时返回 nil；可从任意 goroutine 调用。
+// 返回的 *Conn 可用于 Write 等线程安全操作。
+func (s *Server[C]) Conn(id uint64) *Conn[C] {
+	if v, ok := s.ids.Load(id); ok {
+		return &v.(*connection[C]).api
+	}
 	return nil
 }
 
+// Range 遍历存活连接，fn 返回 false 时停止；可从任意 goroutine 调用。
+// 遍历期间新建或关闭的连接可能出现也可能不出现。
+func (s *Server[C]) Range(fn func(c *Conn[C]) bool) {
+	s.ids.Range(func(_, v any) bool {
+		return fn(&v.(*connection[C]).api)
+	})
+}
+
+// Compressor 返回 Config.CompressionAlgo 对应的压缩算法，
+// Broadcast、Publish 以 Compressed、AlreadyMerged 发送的负载须以它压缩。
+func (s *Server[C]) Compressor() protocol.Compressor { return s.comp }
+
+// NumConns 返回存活连接数。
+func (s *Server[C]) NumConns() int { return int(s.nconns.Load()) }
+
+// Kick 将关闭连接的请求路由到其所属 poller：先刷出并发送带原因的 GOAWAY，
+// 待发送队列写空（最迟 1 秒）后关闭连接，其间不再交付消息，OnClose 收到 reason
+// （为 nil 时为 ErrKicked）。返回调用时连接是否存在。
+func (s *Server[C]) Kick(id uint64, reason error) bool {
+	if _, ok := s.ids.Load(id); !ok {
+		return false
+	}
+	if reason == nil {
+		reason = ErrKicked
+	}
+	idx := int(id & connIDShardMask)
+	if idx >= len(s.shards) {
+		return false
+	}
+	s.shards[idx].post(func() {
+		v, ok := s.ids.Load(id)
+		if !ok {
+			return
+		}
+		c := v.(*connection[C])
+		c.goAway(reason.Error())
+		c.closeAfterFlush(reason)
+	})
+	return true
+}
+
+// stopAccept 在 poller goroutine 中注销并关闭本分片的监听 fd。
+func (s *srvShard[C]) stopAccept() {
+	lfd := s.lfds[s.idx]
+	_ = s.pls[s.idx].Unregister(lfd)
+	_ = closeFD(lfd)
+}
+
+// eachConn 在 poller goroutine 中遍历归属本分片的存活连接。
+func (s *srvShard[C]) eachConn(fn func(c *connection[C])) {
+	s.conns.Range(func(_, v any) bool {
+		if c := v.(*connection[C]); c.sh == s && !c.closed {
+			fn(c)
+		}
+		return true
+	})
+}
+
 func (s *Server[C]) closeAll() {
 	for _, p := range s.pls {
 		p.Close()
@@ -101,6 +250,53 @@ func (s *Server[C]) closeAll() {
 type srvShard[C Cipher] struct {
 	*Server[C]
 	idx int
+	// per-poller 字节池（解压缓冲、CopyToPool 积压等）
+	pool *bufpool.Pool
+	// per-poller 分层时间轮，由事件循环的等待超时驱动
+	tw *timerWheel
+	// 本分片的主题成员表，仅在 poller goroutine 中访问
+	topics map[string]map[*connection[C]]struct{}
+
+	// 投递到本 poller goroutine 执行的任务（MPSC，poller 为唯一消费者）
+	mu    sync.Mutex
+	tasks []func()
+	spare []func()
+	// poller 即将或正在阻塞等待；仅此时投递才需要 eventfd 唤醒
+	sleeping bool
+}
+
+// post 将 fn 投递到本分片的 poller goroutine 执行，可从任意 goroutine 调用。
+func (s *srvShard[C]) post(fn func()) {
+	s.mu.Lock()
+	s.tasks = append(s.tasks, fn)
+	wake := s.sleeping
+	s.sleeping = false
+	s.mu.Unlock()
+	if wake {
+		_ = s.pls[s.idx].Wake()
+	}
+}
+
+// afterFunc 在本分片的时间轮上登记定时器；登记本身经任务队列在 poller goroutine 中完成。
+func (s *srvShard[C]) afterFunc(d time.Duration, fn func()) *Timer {
+	t := &Timer{fn: fn, at: time.Now().Add(d)}
+	s.post(func() { s.tw.add(t) })
+	return t
+}
+
+// runTasks 在 poller goroutine 中执行已投递的任务；执行期间新投递的任务留待下一轮。
+func (s *srvShard[C]) runTasks() {
+	s.mu.Lock()
+	tasks := s.tasks
+	s.tasks = s.spare[:0]
+	s.mu.Unlock()
+	for i, fn := range tasks {
+		fn()
+		tasks[i] = nil
+	}
+	s.mu.Lock()
+	s.spare = tasks[:0]
+	s.mu.Unlock()
 }
 
 type srvHandler[C Cipher] srvShard[C]
@@ -123,8 +319,32 @@ func (s *srvHandler[C]) OnWritable(fd poller.FD) {
 	}
 }
 
+func (s *srvHandler[C]) OnWake() {
+	(*srvShard[C])(s).runTasks()
+}
+
+// NextTimeout 实现 poller.TimerHandler：有待执行任务时不阻塞，否则等到时间轮下一个到期点。
+func (s *srvHandler[C]) NextTimeout() time.Duration {
+	s.mu.Lock()
+	if len(s.tasks) > 0 {
+		s.mu.Unlock()
+		return 0
+	}
+	s.sleeping = true
+	s.mu.Unlock()
+	return s.tw.nextTimeout(time.Now())
+}
+
+func (s *srvHandler[C]) OnTimer() {
+	s.mu.Lock()
+	s.sleeping = false
+	s.mu.Unlock()
+	(*srvShard[C])(s).runTasks()
+	s.tw.advance(time.Now())
+}
+
 func (s *srvHandler[C]) OnClose(fd poller.FD, err error) {
-	if v, ok := s.conns.LoadAndDelete(int(fd)); ok {
+	if v, ok := s.conns.Load(int(fd)); ok {
 		c := v.(*connection[C])
 		c.onClose(err)
 	}
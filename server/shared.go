@@ -0,0 +1,158 @@
+package server
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/legamerdc/gio/internal/bufpool"
+	"github.com/legamerdc/gio/protocol"
+)
+
+// sharedPool 承载 SharedPayload 的帧缓冲，跨 poller 共享。
+var sharedPool = bufpool.New()
+
+// SharedPayload 是只编码（及可选压缩）一次、在多个连接间只读共享的单帧
+// （design.md: 群发支持）。各连接入队时只持有引用而不拷贝，
+// 以原子引用计数管理，最后一次写出或随连接关闭释放后缓冲归还池。
+type SharedPayload struct {
+	frame []byte
+	refs  atomic.Int32
+	// 帧为压缩帧时所用的算法；与连接协商的算法不同时入队前转码
+	comp protocol.Compressor
+}
+
+// NewSharedPayload 经 protocol.Encoder 编码一次 msg；compress 为 true 时仅以默认算法
+// （protocol.DefaultCompression）压缩这一次，写入使用其他算法的连接时按连接转码。
+// 返回的负载持有一个引用，使用完毕后调用方需 Release。
+func NewSharedPayload(api uint16, msg []byte, compress bool) (*SharedPayload, error) {
+	enc, err := protocol.NewEncoder()
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Close()
+	frame, err := enc.EncodeSingle(api, msg, compress)
+	if err != nil {
+		return nil, err
+	}
+	p := newSharedFrame(frame)
+	if compress {
+		p.comp = enc.Compressor()
+	}
+	return p, nil
+}
+
+// encodeShared 按写选项以 comp 将 msg 编码为共享帧（非 Delayed）。
+func encodeShared(api uint16, msg []byte, o writeOpts, comp protocol.Compressor) (*SharedPayload, error) {
+	enc, err := protocol.NewEncoder()
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Close()
+	enc.SetCompressor(comp)
+	var frame []byte
+	switch {
+	case o.merged:
+		frame, err = enc.EncodeFrame(0, msg, true, true)
+	case o.compressed:
+		frame, err = enc.EncodeFrame(api, msg, true, false)
+	default:
+		frame, err = enc.EncodeSingle(api, msg, o.compress)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := newSharedFrame(frame)
+	if o.merged || o.compressed || o.compress {
+		p.comp = comp
+	}
+	return p, nil
+}
+
+// newSharedFrame 将已编码的帧拷入池化缓冲。
+func newSharedFrame(frame []byte) *SharedPayload {
+	p := &SharedPayload{frame: sharedPool.Get(len(frame))}
+	copy(p.frame, frame)
+	p.refs.Store(1)
+	return p
+}
+
+// Len 返回共享帧在线路上的字节数。
+func (p *SharedPayload) Len() int { return len(p.frame) }
+
+func (p *SharedPayload) retain() {
+	if p.refs.Add(1) <= 1 {
+		panic(errSharedReleased)
+	}
+}
+
+// Release 释放一个引用；最后一个引用释放后帧缓冲归还池，之后不得再使用 p，
+// 再次 Release 或写入会 panic。
+func (p *SharedPayload) Release() {
+	switch n := p.refs.Add(-1); {
+	case n == 0:
+		sharedPool.Put(p.frame)
+		p.frame = nil
+	case n < 0:
+		panic(errSharedReleased)
+	}
+}
+
+// errSharedReleased 为 SharedPayload 在最后一个引用释放后仍被使用时的 panic 值。
+var errSharedReleased = errors.New("server: SharedPayload used after its last Release")
+
+// txBuf 为发送队列的一段：私有帧或共享帧的引用。
+type txBuf struct {
+	b  []byte
+	sp *SharedPayload
+}
+
+func (t txBuf) release() {
+	if t.sp != nil {
+		t.sp.Release()
+	}
+}
+
+// WriteShared 将共享帧入队到本连接，不拷贝负载；可从任意 goroutine 调用。
+// 启用 Config.NewCipher 时无法共享密文，退化为按本连接重新加密组帧。
+func (c *Conn[C]) WriteShared(p *SharedPayload) error {
+	if c.runtime == nil {
+		return nil
+	}
+	return c.runtime.writeShared(p)
+}
+
+// Broadcast 向所有满足 filter（nil 表示全部）的连接发送同一条消息，返回成功入队的连接数。
+// 消息只编码一次（opts 含 Compress 时以 Server.Compressor 只压缩一次，协商了其他算法的连接
+// 入队时转码；Compressed、AlreadyMerged 的负载亦须以 Server.Compressor 压缩），以 SharedPayload 跨 poller 共享；
+// opts 含 Delayed 或启用了 Config.NewCipher 时改为逐连接编码。可从任意 goroutine 调用。
+func (s *Server[C]) Broadcast(api uint16, msg []byte, filter func(c *Conn[C]) bool, opts ...WriteOption) (int, error) {
+	o, err := resolveWriteOpts(opts)
+	if err != nil {
+		return 0, err
+	}
+	if protocol.IsControl(api) {
+		return 0, ErrReservedApi
+	}
+	n := 0
+	if o.delayed || s.ciphered() {
+		s.Range(func(c *Conn[C]) bool {
+			if (filter == nil || filter(c)) && c.runtime.write(msg, api, o) == nil {
+				n++
+			}
+			return true
+		})
+		return n, nil
+	}
+	p, err := encodeShared(api, msg, o, s.comp)
+	if err != nil {
+		return 0, err
+	}
+	defer p.Release()
+	s.Range(func(c *Conn[C]) bool {
+		if (filter == nil || filter(c)) && c.runtime.writeShared(p) == nil {
+			n++
+		}
+		return true
+	})
+	return n, nil
+}
@@ -0,0 +1,95 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/legamerdc/gio/protocol"
+	"github.com/legamerdc/gio/server"
+)
+
+func mustPanic(t *testing.T, what string, fn func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s did not panic", what)
+		}
+	}()
+	fn()
+}
+
+// TestSharedPayloadRefs 校验多个连接并发写入同一 SharedPayload 后各自释放引用：
+// 调用方的 Release 恰为最后一次，其后的 Release 与写入 panic。
+func TestSharedPayloadRefs(t *testing.T) {
+	const conns, writes = 4, 50
+	addr := freeAddr(t)
+	h := openHandler{opened: make(chan *server.Conn[nopCipher], conns)}
+	srv, err := server.Start[nopCipher](server.Config[nopCipher]{ListenNetwork: "tcp", ListenAddress: addr}, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop(context.Background())
+	msg := bytes.Repeat([]byte("shared "), 100)
+	p, err := server.NewSharedPayload(7, msg, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var peers []net.Conn
+	for range conns {
+		nc, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer nc.Close()
+		peers = append(peers, nc)
+	}
+	var wg sync.WaitGroup
+	for range conns {
+		var c *server.Conn[nopCipher]
+		select {
+		case c = <-h.opened:
+		case <-time.After(2 * time.Second):
+			t.Fatal("OnOpen timeout")
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range writes {
+				if err := c.WriteShared(p); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// 对端收齐全部帧时，服务端已写出并释放各自的引用
+	for _, nc := range peers {
+		_ = nc.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, writes*p.Len())
+		if _, err := io.ReadFull(nc, buf); err != nil {
+			t.Fatal(err)
+		}
+		prs, _ := protocol.NewParser()
+		n := 0
+		if _, err := prs.Parse(buf, func(api uint16, b []byte) error {
+			if api != 7 || !bytes.Equal(b, msg) {
+				t.Errorf("frame %d: api %d len %d", n, api, len(b))
+			}
+			n++
+			return nil
+		}); err != nil || n != writes {
+			t.Fatalf("parsed %d frames, err %v", n, err)
+		}
+	}
+	p.Release()
+	mustPanic(t, "second Release", p.Release)
+	var c *server.Conn[nopCipher]
+	srv.Range(func(cc *server.Conn[nopCipher]) bool { c = cc; return false })
+	mustPanic(t, "WriteShared after the last Release", func() { _ = c.WriteShared(p) })
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// 分层时间轮（design.md: 定时器）：第 0 层 256 槽，每槽 1 tick；
+// 其余 4 层各 64 槽，逐层放大 64 倍。1ms tick 下可覆盖约 49.7 天，更远的定时器暂存于最高层跨度的末端，
+// 级联时按真实到期 tick 重新登记，不会提前触发。
+// 时间轮归属单个 poller，仅在其 goroutine 内操作，不创建 goroutine 或 time.Timer。
+const (
+	twRootBits = 8
+	twRootSize = 1 << twRootBits
+	twRootMask = twRootSize - 1
+	twLvlBits  = 6
+	twLvlSize  = 1 << twLvlBits
+	twLvlMask  = twLvlSize - 1
+	twLevels   = 4
+	twMaxSpan  = 1<<(twRootBits+twLevels*twLvlBits) - 1
+)
+
+const (
+	timerPending int32 = iota
+	timerFired
+	timerStopped
+)
+
+// Timer 是 AfterFunc 返回的定时器句柄，回调在所属 poller goroutine 中执行。
+type Timer struct {
+	fn     func()
+	at     time.Time // 期望到期时刻，入轮时换算为 tick
+	expire uint64
+	state  atomic.Int32
+	next   *Timer
+}
+
+// Stop 取消尚未触发的定时器，返回是否成功阻止了回调；可从任意 goroutine 调用。
+// 已取消的定时器在其槽位被扫描时才从时间轮摘除。
+func (t *Timer) Stop() bool {
+	return t != nil && t.state.CompareAndSwap(timerPending, timerStopped)
+}
+
+type timerWheel struct {
+	tick  time.Duration
+	start time.Time
+	next  uint64 // 下一个待处理的 tick
+	count int    // 轮内定时器数（含已取消未摘除的）
+	root  [twRootSize]*Timer
+	used  [twRootSize / 64]uint64 // 第 0 层非空槽位图
+	lvls  [twLevels][twLvlSize]*Timer
+}
+
+func newTimerWheel(tick time.Duration) *timerWheel {
+	return &timerWheel{tick: tick, start: time.Now()}
+}
+
+// add 将定时器按到期 tick 登记到对应层级的槽位。
+func (tw *timerWheel) add(t *Timer) {
+	if t.state.Load() != timerPending {
+		return
+	}
+	// 向上取整到 tick；不晚于轮起点（含 d<=0 的 AfterFunc）的定时器在下一个 tick 触发
+	if d := t.at.Sub(tw.start); d <= 0 {
+		t.expire = tw.next
+	} else {
+		t.expire = uint64(d / tw.tick)
+		if d%tw.tick != 0 {
+			t.expire++
+		}
+	}
+	tw.count++
+	tw.insert(t)
+}
+
+func (tw *timerWheel) insert(t *Timer) {
+	exp := t.expire
+	if exp < tw.next {
+		// 已过期：放入当前槽，下一次推进即触发
+		exp = tw.next
+	}
+	idx := exp - tw.next
+	if idx < twRootSize {
+		i := exp & twRootMask
+		t.next = tw.root[i]
+		tw.root[i] = t
+		tw.used[i/64] |= 1 << (i % 64)
+		return
+	}
+	if idx > twMaxSpan {
+		// 超出跨度：按跨度末端选槽，该槽级联时以 t.expire 重新登记
+		exp, idx = tw.next+twMaxSpan, twMaxSpan
+	}
+	for l := 0; l < twLevels; l++ {
+		if idx < 1<<(twRootBits+(l+1)*twLvlBits) {
+			i := (exp >> (twRootBits + l*twLvlBits)) & twLvlMask
+			t.next = tw.lvls[l][i]
+			tw.lvls[l][i] = t
+			return
+		}
+	}
+}
+
+// cascade 将第 l 层槽位 i 中的定时器重新分配到更低层级，返回 i。
+func (tw *timerWheel) cascade(l int, i uint64) uint64 {
+	t := tw.lvls[l][i]
+	tw.lvls[l][i] = nil
+	for t != nil {
+		nx := t.next
+		t.next = nil
+		if t.state.Load() == timerPending {
+			tw.insert(t)
+		} else {
+			tw.count--
+		}
+		t = nx
+	}
+	return i
+}
+
+// advance 推进到 now，按到期顺序执行回调。
+func (tw *timerWheel) advance(now time.Time) {
+	target := uint64(now.Sub(tw.start) / tw.tick)
+	for tw.next <= target {
+		if tw.count == 0 {
+			tw.next = target + 1
+			return
+		}
+		idx := tw.next & twRootMask
+		if idx == 0 {
+			for l := 0; l < twLevels; l++ {
+				if tw.cascade(l, (tw.next>>(twRootBits+l*twLvlBits))&twLvlMask) != 0 {
+					break
+				}
+			}
+		}
+		if tw.used == [twRootSize / 64]uint64{} {
+			// 第 0 层为空：直接跳到下一个级联边界
+			tw.next = min(target+1, (tw.next|twRootMask)+1)
+			continue
+		}
+		tw.next++
+		t := tw.root[idx]
+		tw.root[idx] = nil
+		tw.used[idx/64] &^= 1 << (idx % 64)
+		for t != nil {
+			nx := t.next
+			t.next = nil
+			tw.count--
+			if t.state.CompareAndSwap(timerPending, timerFired) {
+				t.fn()
+			}
+			t = nx
+		}
+	}
+}
+
+// nextTimeout 返回距离下一个可能到期点的时长；轮空时返回 -1。
+// 第 0 层无定时器时，以下一次级联的边界作为唤醒点。
+func (tw *timerWheel) nextTimeout(now time.Time) time.Duration {
+	if tw.count == 0 {
+		return -1
+	}
+	ticks := uint64(twRootSize) - tw.next&twRootMask
+	if k, ok := tw.firstUsed(); ok && k < ticks {
+		ticks = k
+	}
+	d := tw.start.Add(time.Duration(tw.next+ticks) * tw.tick).Sub(now)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// firstUsed 返回从当前槽位起第一个非空槽的偏移。
+func (tw *timerWheel) firstUsed() (uint64, bool) {
+	cur := tw.next & twRootMask
+	for k := uint64(0); k < twRootSize; {
+		i := (cur + k) & twRootMask
+		w := tw.used[i/64] >> (i % 64)
+		if w != 0 {
+			return k + uint64(bits.TrailingZeros64(w)), true
+		}
+		k += 64 - i%64
+	}
+	return 0, false
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+)
+
+const testTick = time.Millisecond
+
+// firing 记录定时器触发时所处的 tick。
+type firing struct {
+	id   int
+	tick uint64
+}
+
+// wheelRec 为记录触发顺序的时间轮，以合成时刻推进。
+type wheelRec struct {
+	tw    *timerWheel
+	start time.Time
+	fired []firing
+}
+
+func newWheelRec() *wheelRec {
+	tw := newTimerWheel(testTick)
+	return &wheelRec{tw: tw, start: tw.start}
+}
+
+// at 返回第 k 个 tick 的时刻。
+func (w *wheelRec) at(k uint64) time.Time { return w.start.Add(time.Duration(k) * testTick) }
+
+func (w *wheelRec) add(id int, at time.Time) *Timer {
+	t := &Timer{at: at}
+	t.fn = func() { w.fired = append(w.fired, firing{id, w.tw.next - 1}) }
+	w.tw.add(t)
+	return t
+}
+
+func TestTimerWheelOrdering(t *testing.T) {
+	w := newWheelRec()
+	rng := rand.New(rand.NewPCG(1, 2))
+	// 覆盖第 0 层至第 2 层
+	want := make([]uint64, 2000)
+	for i := range want {
+		want[i] = 1 + rng.Uint64N(1<<21)
+		w.add(i, w.at(want[i]))
+	}
+	for now := uint64(0); now <= 1<<21; now += 1 + rng.Uint64N(5000) {
+		w.tw.advance(w.at(now))
+	}
+	w.tw.advance(w.at(1 << 21))
+	if len(w.fired) != len(want) {
+		t.Fatalf("fired %d timers, want %d", len(w.fired), len(want))
+	}
+	for i, f := range w.fired {
+		if f.tick != want[f.id] {
+			t.Fatalf("timer %d fired at tick %d, want %d", f.id, f.tick, want[f.id])
+		}
+		if i > 0 && f.tick < w.fired[i-1].tick {
+			t.Fatalf("timer %d (tick %d) fired after tick %d", f.id, f.tick, w.fired[i-1].tick)
+		}
+	}
+	if w.tw.count != 0 {
+		t.Fatalf("count = %d after all timers fired", w.tw.count)
+	}
+}
+
+// TestTimerWheelCascade 校验各层定时器经级联后恰在到期 tick 触发。
+func TestTimerWheelCascade(t *testing.T) {
+	w := newWheelRec()
+	// 各层边界两侧，含第 3 层
+	ticks := []uint64{1, 255, 256, 257, 1<<14 - 1, 1 << 14, 1<<14 + 1, 1<<20 - 1, 1 << 20, 1<<20 + 300, 1<<26 - 1, 1 << 26, 1<<26 + 12345}
+	for i, k := range ticks {
+		w.add(i, w.at(k))
+	}
+	// 先推进到中途，再登记跨层的定时器，使其相对当前 tick 选槽
+	w.tw.advance(w.at(1000))
+	ticks = append(ticks, 1000+1<<14+7, 1000+1<<20+7)
+	w.add(len(ticks)-2, w.at(ticks[len(ticks)-2]))
+	w.add(len(ticks)-1, w.at(ticks[len(ticks)-1]))
+	w.tw.advance(w.at(1<<26 + 20000))
+	got := make([]uint64, len(ticks))
+	for _, f := range w.fired {
+		if got[f.id] != 0 {
+			t.Fatalf("timer %d fired twice", f.id)
+		}
+		got[f.id] = f.tick
+	}
+	if !slices.Equal(got, ticks) {
+		t.Fatalf("fired at %v, want %v", got, ticks)
+	}
+}
+
+func TestTimerWheelStop(t *testing.T) {
+	w := newWheelRec()
+	var timers []*Timer
+	for i := range 200 {
+		timers = append(timers, w.add(i, w.at(uint64(1+i*997))))
+	}
+	for i, tm := range timers {
+		if i%2 == 1 && !tm.Stop() {
+			t.Fatalf("Stop(%d) = false on a pending timer", i)
+		}
+	}
+	w.tw.advance(w.at(200 * 997))
+	if len(w.fired) != 100 {
+		t.Fatalf("fired %d timers, want 100", len(w.fired))
+	}
+	for _, f := range w.fired {
+		if f.id%2 == 1 {
+			t.Fatalf("stopped timer %d fired", f.id)
+		}
+	}
+	if timers[0].Stop() {
+		t.Fatal("Stop on a fired timer returned true")
+	}
+	if w.tw.count != 0 {
+		t.Fatalf("count = %d, want 0 after stopped timers are swept", w.tw.count)
+	}
+}
+
+// TestTimerWheelPast 校验不晚于当前时刻（含早于轮起点）的定时器在下一个 tick 触发。
+func TestTimerWheelPast(t *testing.T) {
+	w := newWheelRec()
+	w.tw.advance(w.at(10))
+	w.add(0, w.start.Add(-time.Hour))
+	w.add(1, w.start)
+	w.add(2, w.at(5))
+	w.add(3, w.at(10))
+	w.tw.advance(w.at(11))
+	if len(w.fired) != 4 {
+		t.Fatalf("fired %v, want all 4 timers", w.fired)
+	}
+	for _, f := range w.fired {
+		if f.tick != 11 {
+			t.Fatalf("timer %d fired at tick %d, want 11", f.id, f.tick)
+		}
+	}
+}
+
+// TestTimerWheelBeyondSpan 校验超出跨度的定时器不会提前触发，且恰在到期 tick 触发。
+func TestTimerWheelBeyondSpan(t *testing.T) {
+	w := newWheelRec()
+	exp := uint64(twMaxSpan) + 5000
+	w.add(0, w.at(exp))
+	w.add(1, w.start.Add(math.MaxInt64))
+	w.tw.advance(w.at(exp - 1))
+	if len(w.fired) != 0 {
+		t.Fatalf("fired early: %v", w.fired)
+	}
+	w.tw.advance(w.at(exp))
+	if len(w.fired) != 1 || w.fired[0] != (firing{0, exp}) {
+		t.Fatalf("fired %v, want timer 0 at tick %d", w.fired, exp)
+	}
+	if w.tw.count != 1 {
+		t.Fatalf("count = %d, want the far timer still pending", w.tw.count)
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// TLS（Config.TLS）：crypto/tls 需要阻塞式 net.Conn，而连接由 poller 以非阻塞方式驱动。
+// 二者之间以内存中的 tlsShim 衔接：
+//   - 握手阶段 shim 为阻塞模式，tls 握手在独立 goroutine 中运行，Read 等待 poller 喂入的密文；
+//   - 握手完成后切换为非阻塞模式，poller 读到密文即经 tls.Conn.Read 解出明文放入 rx 环，
+//     密文不足一条记录时 shim 返回 Temporary 错误，tls.Conn 不会将其视为致命错误；
+//   - 发送时帧经 tls.Conn.Write 加密，shim.Write 将密文直接排入发送队列，从不阻塞。
+// 握手超时沿用 Config.HandshakeTimeout；启用 Config.Handshake 时应用层握手在 TLS 之内进行。
+
+// errWouldBlock 表示 shim 中暂无密文可读（非阻塞模式）。
+var errWouldBlock net.Error = wouldBlockError{}
+
+type wouldBlockError struct{}
+
+func (wouldBlockError) Error() string   { return "server: tls shim would block" }
+func (wouldBlockError) Timeout() bool   { return true }
+func (wouldBlockError) Temporary() bool { return true }
+
+// tlsShim 为 tls.Conn 的底层连接；enqueue 将密文排入所属连接的发送队列。
+type tlsShim struct {
+	fd      int
+	enqueue func(b []byte) error
+	mu      sync.Mutex
+	cond    sync.Cond
+	in      []byte
+	// 握手期间为 true：Read 等待数据
+	blocking bool
+	closed   bool
+}
+
+// tlsMaxInput 为 shim 缓冲密文的上限：一条最大的 TLS 记录（2^14 字节明文加 2048 字节扩展）及其 5 字节头部。
+// 握手 goroutine 消费不及时（或握手已结束、结果尚未投递）时，超出即以 ErrTLSInputOverflow 终止握手。
+const tlsMaxInput = 5 + 16<<10 + 2048
+
+func newTLSShim(fd int, enqueue func(b []byte) error) *tlsShim {
+	s := &tlsShim{fd: fd, enqueue: enqueue, blocking: true, in: make([]byte, 0, tlsMaxInput)}
+	s.cond.L = &s.mu
+	return s
+}
+
+func (s *tlsShim) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.in) == 0 {
+		if s.closed {
+			return 0, io.EOF
+		}
+		if !s.blocking {
+			return 0, errWouldBlock
+		}
+		s.cond.Wait()
+	}
+	n := copy(p, s.in)
+	s.in = s.in[:copy(s.in, s.in[n:])]
+	return n, nil
+}
+
+// Write 将密文排入连接的发送队列；enqueue 须拷贝 p（tls 会复用 p）。
+func (s *tlsShim) Write(p []byte) (int, error) {
+	if err := s.enqueue(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// readFrom 从 fd 读取一次密文到缓冲，唤醒等待中的握手；缓冲已满时返回 ErrTLSInputOverflow。
+func (s *tlsShim) readFrom(fd int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.in) >= tlsMaxInput {
+		return 0, ErrTLSInputOverflow
+	}
+	n, err := unix.Read(fd, s.in[len(s.in):tlsMaxInput])
+	if n > 0 {
+		s.in = s.in[:len(s.in)+n]
+		s.cond.Broadcast()
+	}
+	return n, err
+}
+
+func (s *tlsShim) setBlocking(on bool) {
+	s.mu.Lock()
+	s.blocking = on
+	s.mu.Unlock()
+}
+
+func (s *tlsShim) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *tlsShim) LocalAddr() net.Addr {
+	sa, _ := unix.Getsockname(s.fd)
+	return sockaddrToTCP(sa)
+}
+
+func (s *tlsShim) RemoteAddr() net.Addr {
+	sa, _ := unix.Getpeername(s.fd)
+	return sockaddrToTCP(sa)
+}
+
+func (s *tlsShim) SetDeadline(time.Time) error      { return nil }
+func (s *tlsShim) SetReadDeadline(time.Time) error  { return nil }
+func (s *tlsShim) SetWriteDeadline(time.Time) error { return nil }
+
+func sockaddrToTCP(sa unix.Sockaddr) net.Addr {
+	switch a := sa.(type) {
+	case *unix.SockaddrInet4:
+		return &net.TCPAddr{IP: a.Addr[:], Port: a.Port}
+	case *unix.SockaddrInet6:
+		return &net.TCPAddr{IP: a.Addr[:], Port: a.Port}
+	}
+	return &net.TCPAddr{}
+}
+
+// initTLS 在连接构造时创建 tls.Conn；握手由 startTLS 在连接注册后启动。
+func (c *connection[C]) initTLS() {
+	c.shim = newTLSShim(c.fd, c.enqueueCopy)
+	c.tls = tls.Server(c.shim, c.srv.cfg.TLS)
+	c.tlsPending = true
+}
+
+// startTLS 在独立 goroutine 中完成 TLS 握手，结果投递回 poller goroutine。
+func (c *connection[C]) startTLS() {
+	go func() {
+		err := c.tls.HandshakeContext(c.ctx)
+		c.sh.post(func() { c.onTLSHandshake(err) })
+	}()
+}
+
+// onTLSHandshake 在 poller goroutine 中处理 TLS 握手结果。
+func (c *connection[C]) onTLSHandshake(err error) {
+	if c.closed {
+		return
+	}
+	if err != nil {
+		c.handshakeFailed(err)
+		return
+	}
+	c.shim.setBlocking(false)
+	c.tlsPending = false
+	if !c.hsPending {
+		c.ready()
+	}
+	// 交付握手期间已到达的数据
+	c.onReadable()
+}
+
+// onReadableTLS 读取密文并解出明文交给 parseRx。
+func (c *connection[C]) onReadableTLS() {
+	for !c.closed && !c.readPaused() {
+		if !c.tlsPending {
+			if err := c.drainTLS(); err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				c.onClose(err)
+				return
+			}
+			if c.closed || c.readPaused() {
+				return
+			}
+		}
+		n, err := c.shim.readFrom(c.fd)
+		if n > 0 {
+			c.lastRx = time.Now()
+			continue
+		}
+		if err == unix.EAGAIN || err == unix.EWOULDBLOCK {
+			return
+		}
+		if err == ErrTLSInputOverflow {
+			c.handshakeFailed(err)
+			return
+		}
+		c.onClose(err)
+		return
+	}
+}
+
+// drainTLS 将 tls.Conn 中可解出的明文全部读入 rx 环并解析；暂无完整记录时返回 nil。
+func (c *connection[C]) drainTLS() error {
+	for {
+		w := c.rx.WritableSlice()
+		if len(w) == 0 {
+			return ErrRxOverflow
+		}
+		n, err := c.tls.Read(w)
+		if n > 0 {
+			c.rx.Commit(n)
+			if perr := c.parseRx(); perr != nil {
+				return perr
+			}
+			if c.closed || c.readPaused() {
+				return nil
+			}
+		}
+		if err != nil {
+			if err == errWouldBlock {
+				return nil
+			}
+			if err == io.EOF {
+				return err
+			}
+			return fmt.Errorf("server: tls: %w", err)
+		}
+	}
+}
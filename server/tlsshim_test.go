@@ -0,0 +1,56 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// TestTLSShimInputCap 校验握手期间 shim 缓冲的密文不超过 tlsMaxInput，超出时返回 ErrTLSInputOverflow。
+func TestTLSShimInputCap(t *testing.T) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fds[0])
+	defer unix.Close(fds[1])
+	if err := unix.SetNonblock(fds[0], true); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.SetNonblock(fds[1], true); err != nil {
+		t.Fatal(err)
+	}
+	flood := make([]byte, 8<<10)
+	for {
+		if _, err := unix.Write(fds[1], flood); err != nil {
+			break // 对端缓冲已满
+		}
+	}
+	s := newTLSShim(fds[0], func([]byte) error { return nil })
+	total := 0
+	for {
+		n, err := s.readFrom(fds[0])
+		total += n
+		if err != nil {
+			if !errors.Is(err, ErrTLSInputOverflow) {
+				t.Fatalf("readFrom after %d bytes: %v, want ErrTLSInputOverflow", total, err)
+			}
+			break
+		}
+		if n == 0 {
+			t.Fatalf("readFrom returned 0 bytes without error after %d bytes", total)
+		}
+	}
+	if total != tlsMaxInput || len(s.in) != tlsMaxInput || cap(s.in) != tlsMaxInput {
+		t.Fatalf("buffered %d bytes (len %d, cap %d), want %d", total, len(s.in), cap(s.in), tlsMaxInput)
+	}
+	// 握手消费之后可继续读取
+	p := make([]byte, 1024)
+	if n, err := s.Read(p); n != len(p) || err != nil {
+		t.Fatalf("Read = %d, %v", n, err)
+	}
+	if n, err := s.readFrom(fds[0]); n != len(p) || err != nil {
+		t.Fatalf("readFrom after Read = %d, %v, want %d", n, err, len(p))
+	}
+}
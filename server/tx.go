@@ -3,60 +3,125 @@ package server
 import (
 	"sync"
 	"time"
+
+	"github.com/legamerdc/gio/protocol"
 )
 
-type txMsg struct {
-	api  uint16
-	data []byte
-}
+type writeOptKind uint8
 
-type txAggregator struct {
-	mu     sync.Mutex
-	queue  []txMsg
+const (
+	optImmediate writeOptKind = iota
+	optDelayed
+	optCompressed
+	optMerged
+	optCompress
+)
+
+// WriteOption 描述 Conn.Write 的发送语义（design.md: 发送路径）。
+type WriteOption struct {
+	kind   writeOptKind
 	window time.Duration
-	bytes  int
-	maxB   int
 }
 
-func newTxAggregator(window time.Duration, maxBytes int) *txAggregator {
-	return &txAggregator{window: window, maxB: maxBytes}
+var (
+	// Immediate 立即发送原始消息（默认）。
+	Immediate = WriteOption{kind: optImmediate}
+	// Compressed 表示 msg 已由业务侧压缩，按 Compressed 单帧直接发送。
+	Compressed = WriteOption{kind: optCompressed}
+	// AlreadyMerged 表示 msg 已是“批量且压缩好”的负载，忽略 api，以 Batched 帧直接发送。
+	AlreadyMerged = WriteOption{kind: optMerged}
+	// Compress 由框架压缩后以 Compressed 单帧发送（Delayed 批量帧本身总是压缩）。
+	Compress = WriteOption{kind: optCompress}
+)
+
+// Delayed 将消息放入连接的聚合队列，在 window 内与其他消息合并为一个批量压缩帧；
+// window<=0 时使用 Config.TxBatchWindow。
+func Delayed(window time.Duration) WriteOption {
+	return WriteOption{kind: optDelayed, window: window}
 }
 
-func (t *txAggregator) add(api uint16, data []byte) (ready [][]txMsg) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	t.queue = append(t.queue, txMsg{api: api, data: data})
-	t.bytes += len(data)
-	if t.bytes >= t.maxB || len(t.queue) >= 16 {
-		ready = append(ready, t.queue)
-		t.queue = nil
-		t.bytes = 0
+type writeOpts struct {
+	delayed    bool
+	window     time.Duration
+	compressed bool
+	merged     bool
+	compress   bool
+}
+
+func resolveWriteOpts(opts []WriteOption) (o writeOpts, _ error) {
+	for _, op := range opts {
+		switch op.kind {
+		case optImmediate:
+			o.delayed = false
+		case optDelayed:
+			o.delayed = true
+			o.window = op.window
+		case optCompressed:
+			o.compressed = true
+		case optMerged:
+			o.merged = true
+		case optCompress:
+			o.compress = true
+		}
 	}
-	return
+	if o.compressed && o.merged {
+		return o, ErrInvalidWriteOption
+	}
+	// 批内消息不得再压缩或再组合：已压缩负载按即发处理
+	if o.compressed || o.merged {
+		o.delayed = false
+	}
+	return o, nil
 }
 
-// 时间轮：每个 shard 一个 1ms ticker，扫描所有连接是否到期（简化，直接轮询当前队列）。
+type txMsg struct {
+	api uint16
+	off int
+	n   int
+}
 
-type timerWheel struct {
-	interval time.Duration
-	stopCh   chan struct{}
+// txAggregator 暂存延迟发送的消息（design.md: txStaging），
+// 负载拷贝进连续缓冲，刷新时编码为一个批量帧。
+// mu 同时串行化该连接的所有写入，保证立即/延迟消息的相对顺序。
+type txAggregator struct {
+	mu       sync.Mutex
+	buf      []byte
+	queue    []txMsg
+	items    []protocol.BatchItem
+	deadline time.Time
+	maxB     int
+	maxN     int
 }
 
-func newTimerWheel(interval time.Duration) *timerWheel {
-	return &timerWheel{interval: interval, stopCh: make(chan struct{})}
+func newTxAggregator(maxBytes, maxMsgs int) *txAggregator {
+	return &txAggregator{maxB: maxBytes, maxN: maxMsgs}
 }
 
-func (tw *timerWheel) run(onTick func()) {
-	tk := time.NewTicker(tw.interval)
-	defer tk.Stop()
-	for {
-		select {
-		case <-tk.C:
-			onTick()
-		case <-tw.stopCh:
-			return
-		}
+// add 暂存一条消息；返回批的到期时刻是否提前（需登记到时间轮）以及是否已达阈值。
+func (t *txAggregator) add(api uint16, data []byte, deadline time.Time) (sched, full bool) {
+	if len(t.queue) == 0 || deadline.Before(t.deadline) {
+		t.deadline = deadline
+		sched = true
 	}
+	t.queue = append(t.queue, txMsg{api: api, off: len(t.buf), n: len(data)})
+	t.buf = append(t.buf, data...)
+	return sched, len(t.buf) >= t.maxB || len(t.queue) >= t.maxN
 }
 
-func (tw *timerWheel) stop() { close(tw.stopCh) }
+// take 取出当前暂存的批，返回的切片在下一次 reset 前有效。
+func (t *txAggregator) take() []protocol.BatchItem {
+	t.items = t.items[:0]
+	for _, m := range t.queue {
+		t.items = append(t.items, protocol.BatchItem{Api: m.api, Payload: t.buf[m.off : m.off+m.n]})
+	}
+	return t.items
+}
+
+func (t *txAggregator) reset() {
+	t.buf = t.buf[:0]
+	t.queue = t.queue[:0]
+	for i := range t.items {
+		t.items[i] = protocol.BatchItem{}
+	}
+	t.items = t.items[:0]
+}
@@ -0,0 +1,126 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/legamerdc/gio/server"
+)
+
+type openHandler struct{ opened chan *server.Conn[nopCipher] }
+
+func (h openHandler) OnOpen(c *server.Conn[nopCipher]) { h.opened <- c }
+
+func (openHandler) OnMessage(c *server.Conn[nopCipher], api uint16, msg []byte) bool { return false }
+
+func (openHandler) OnClose(c *server.Conn[nopCipher], err error) {}
+
+// TestWriteZeroAlloc 校验明文连接的 Conn.Write 在稳态下直接编码进输出缓冲、不分配内存。
+func TestWriteZeroAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops items under the race detector")
+	}
+	for _, tc := range []struct {
+		name string
+		cfg  server.Config[nopCipher]
+	}{{"stateless", server.Config[nopCipher]{}}, {"context", server.Config[nopCipher]{ContextTakeover: 64 << 10}}} {
+		t.Run(tc.name, func(t *testing.T) {
+			addr := freeAddr(t)
+			h := openHandler{opened: make(chan *server.Conn[nopCipher], 1)}
+			cfg := tc.cfg
+			cfg.ListenNetwork, cfg.ListenAddress = "tcp", addr
+			srv, err := server.Start[nopCipher](cfg, h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer srv.Stop(context.Background())
+			nc, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer nc.Close()
+			go io.Copy(io.Discard, nc)
+			var c *server.Conn[nopCipher]
+			select {
+			case c = <-h.opened:
+			case <-time.After(2 * time.Second):
+				t.Fatal("OnOpen timeout")
+			}
+
+			msg := []byte("hello world, this is a message of moderate size for the alloc test")
+			for _, wc := range []struct {
+				name string
+				opts []server.WriteOption
+			}{{"immediate", nil}, {"compress", []server.WriteOption{server.Compress}}} {
+				// 容忍读端偶发的调度分配，每条消息一次分配的回归仍会被发现
+				if a := testing.AllocsPerRun(2000, func() { _ = c.Write(msg, 1, wc.opts...) }); a > 0.1 {
+					t.Errorf("%s: %.2f allocs/op, want 0", wc.name, a)
+				}
+			}
+		})
+	}
+}
+
+// TestWriteErrorsNotLogged 校验 Conn.Write 的背压与已关闭错误只返回给调用方，不写日志。
+func TestWriteErrorsNotLogged(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	addr := freeAddr(t)
+	h := openHandler{opened: make(chan *server.Conn[nopCipher], 1)}
+	srv, err := server.Start[nopCipher](server.Config[nopCipher]{
+		ListenNetwork:   "tcp",
+		ListenAddress:   addr,
+		TxHighWatermark: 64 << 10,
+	}, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop(context.Background())
+	// 对端不读取，发送队列终将越过高水位
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	var c *server.Conn[nopCipher]
+	select {
+	case c = <-h.opened:
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnOpen timeout")
+	}
+	msg := make([]byte, 32<<10)
+	for i := 0; ; i++ {
+		if err = c.Write(msg, 1); err != nil {
+			break
+		}
+		if i == 1<<16 {
+			t.Fatal("no backpressure")
+		}
+	}
+	if !errors.Is(err, server.ErrBackpressure) {
+		t.Fatalf("Write err = %v, want ErrBackpressure", err)
+	}
+	c.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for err = c.Write(msg, 1); !errors.Is(err, server.ErrConnClosed); err = c.Write(msg, 1) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Write after Close = %v, want ErrConnClosed", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := new(server.Conn[nopCipher]).Write(msg, 1); !errors.Is(err, server.ErrConnClosed) {
+		t.Fatalf("Write on an unattached Conn = %v, want ErrConnClosed", err)
+	}
+	if logged.Len() > 0 {
+		t.Fatalf("Write logged: %s", logged.String())
+	}
+}